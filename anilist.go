@@ -0,0 +1,131 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"hianime-mpv-go/anilist"
+	"hianime-mpv-go/config"
+	"hianime-mpv-go/paths"
+	"hianime-mpv-go/state"
+)
+
+const anilistUsage = `Usage:
+  anilist login [--client-id ID]   Authorize the app and store the token in the config
+  anilist status                   Show the logged in user and the updates waiting to be sent
+  anilist pull                     Seed the library progress and statuses from your AniList list
+  anilist sync                     Send the queued updates and the progress of every series
+
+Progress is sent automatically once an episode counts as watched, see watched_threshold in the config.`
+
+func cmdAnilist(args []string, history []state.History, configSession config.Settings) error {
+	action := "status"
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		action, args = args[0], args[1:]
+	}
+
+	if action == "login" {
+		return anilistLogin(args, configSession)
+	}
+	if action == "help" {
+		fmt.Println(anilistUsage)
+		return nil
+	}
+
+	positional, err := parseInterleaved(newFlagSet("anilist"), args)
+	if err != nil || len(positional) != 0 {
+		fmt.Fprintln(os.Stderr, anilistUsage)
+		return errUsage
+	}
+	if anilist.Default == nil {
+		return fmt.Errorf("Not logged in to AniList, run 'anilist login' first")
+	}
+
+	switch action {
+	case "status":
+		viewer, err := anilist.Default.Viewer()
+		if err != nil {
+			return err
+		}
+		queue, err := anilist.Queued()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("--> Logged in as %s (id %d), %d update(s) queued\n", viewer.Name, viewer.ID, len(queue))
+		return nil
+
+	case "pull":
+		matched, total, err := anilist.Default.Pull()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("--> %d of %d AniList entries matched a series in the library\n", matched, total)
+		return nil
+
+	case "sync":
+		sent, err := anilist.Default.Flush()
+		if err != nil {
+			return err
+		}
+		for _, h := range history {
+			entry, ok := anilist.EntryFor(h)
+			if !ok || entry.Progress == 0 {
+				continue
+			}
+			if err := anilist.Default.Push(entry); err != nil {
+				return fmt.Errorf("Failed to sync %s: %w", h.JapaneseName, err)
+			}
+			sent++
+		}
+		fmt.Printf("--> Sent %d update(s) to AniList\n", sent)
+		return nil
+	}
+
+	fmt.Fprintln(os.Stderr, anilistUsage)
+	return errUsage
+}
+
+func anilistLogin(args []string, configSession config.Settings) error {
+	fs := newFlagSet("anilist login")
+	clientID := fs.String("client-id", configSession.Anilist.ClientID, "Id of your AniList API client (anilist.co/settings/developer)")
+
+	positional, err := parseInterleaved(fs, args)
+	if err != nil || len(positional) != 0 {
+		return errUsage
+	}
+	if *clientID == "" {
+		return fmt.Errorf("Create an API client at https://anilist.co/settings/developer with https://anilist.co/api/v2/oauth/pin as redirect url, then run 'anilist login --client-id <id>'")
+	}
+
+	fmt.Printf("Open this url, approve the app and paste the token shown:\n\n  %s\n\nToken: ", fmt.Sprintf(anilist.AuthorizeUrl, *clientID))
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024)
+	scanner.Scan()
+	token := strings.TrimSpace(scanner.Text())
+	if token == "" {
+		return fmt.Errorf("No token entered")
+	}
+
+	viewer, err := anilist.NewClient(token).Viewer()
+	if err != nil {
+		return err
+	}
+
+	// Reloaded so flag overrides of this run don't end up in the file.
+	saved, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+	if paths.Profile == "" {
+		saved.Anilist = config.AnilistSettings{ClientID: *clientID, Token: token}
+	} else if err := saved.SetProfileValue(paths.Profile, "anilist", config.AnilistSettings{ClientID: *clientID, Token: token}); err != nil {
+		return err
+	}
+	if err := config.SaveConfig(saved); err != nil {
+		return err
+	}
+	fmt.Printf("--> Logged in as %s. Run 'anilist pull' to import your progress.\n", viewer.Name)
+	return nil
+}
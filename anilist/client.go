@@ -0,0 +1,188 @@
+// Package anilist keeps the AniList list of the user in step with the local history through the GraphQL API.
+package anilist
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var Endpoint string = "https://graphql.anilist.co"
+
+// AuthorizeUrl is where the user approves the app and gets a token back (implicit grant).
+const AuthorizeUrl = "https://anilist.co/api/v2/oauth/authorize?client_id=%s&response_type=token"
+
+// AniList list statuses.
+const (
+	StatusCurrent   = "CURRENT"
+	StatusPlanning  = "PLANNING"
+	StatusCompleted = "COMPLETED"
+	StatusDropped   = "DROPPED"
+	StatusPaused    = "PAUSED"
+	StatusRepeating = "REPEATING"
+)
+
+type Client struct {
+	Token    string
+	Endpoint string
+	HTTP     *http.Client
+}
+
+func NewClient(token string) *Client {
+	return &Client{
+		Token:    token,
+		Endpoint: Endpoint,
+		HTTP:     &http.Client{Timeout: 15 * time.Second},
+	}
+}
+
+type graphqlRequest struct {
+	Query     string         `json:"query"`
+	Variables map[string]any `json:"variables,omitempty"`
+}
+
+type graphqlResponse struct {
+	Data   json.RawMessage `json:"data"`
+	Errors []struct {
+		Message string `json:"message"`
+	} `json:"errors"`
+}
+
+// query sends a GraphQL request and decodes its data into out.
+func (c *Client) query(query string, variables map[string]any, out any) error {
+	body, err := json.Marshal(graphqlRequest{Query: query, Variables: variables})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", c.Endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Accept", "application/json")
+	if c.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.Token)
+	}
+
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return fmt.Errorf("Failed to reach AniList: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result graphqlResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return fmt.Errorf("Failed to decode AniList response (%s): %w", resp.Status, err)
+	}
+	if len(result.Errors) > 0 {
+		messages := make([]string, len(result.Errors))
+		for i, e := range result.Errors {
+			messages[i] = e.Message
+		}
+		return fmt.Errorf("AniList: %s", strings.Join(messages, "; "))
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("AniList returned %s", resp.Status)
+	}
+
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(result.Data, out)
+}
+
+type Viewer struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// Viewer returns the user the token belongs to.
+func (c *Client) Viewer() (Viewer, error) {
+	var data struct {
+		Viewer Viewer `json:"Viewer"`
+	}
+	err := c.query(`query { Viewer { id name } }`, nil, &data)
+	return data.Viewer, err
+}
+
+// Entry is one anime of the user's list.
+type Entry struct {
+	MediaID  int    `json:"mediaId"`
+	Status   string `json:"status"`
+	Progress int    `json:"progress"`
+}
+
+// SaveMediaListEntry creates or updates the list entry of an anime.
+func (c *Client) SaveMediaListEntry(entry Entry) error {
+	const mutation = `mutation ($mediaId: Int, $status: MediaListStatus, $progress: Int) {
+  SaveMediaListEntry(mediaId: $mediaId, status: $status, progress: $progress) { id }
+}`
+	return c.query(mutation, map[string]any{
+		"mediaId":  entry.MediaID,
+		"status":   entry.Status,
+		"progress": entry.Progress,
+	}, nil)
+}
+
+// List returns every anime on the list of userID.
+func (c *Client) List(userID int) ([]Entry, error) {
+	const query = `query ($userId: Int) {
+  MediaListCollection(userId: $userId, type: ANIME) { lists { entries { mediaId status progress } } }
+}`
+	var data struct {
+		MediaListCollection struct {
+			Lists []struct {
+				Entries []Entry `json:"entries"`
+			} `json:"lists"`
+		} `json:"MediaListCollection"`
+	}
+	if err := c.query(query, map[string]any{"userId": userID}, &data); err != nil {
+		return nil, err
+	}
+
+	var entries []Entry
+	for _, list := range data.MediaListCollection.Lists {
+		entries = append(entries, list.Entries...)
+	}
+	return entries, nil
+}
+
+// AnilistIDs maps MyAnimeList ids to AniList ids. Ids AniList doesn't know are left out. It works without a token.
+func (c *Client) AnilistIDs(malIDs []int) (map[int]int, error) {
+	const query = `query ($ids: [Int], $page: Int) {
+  Page(page: $page, perPage: 50) { pageInfo { hasNextPage } media(idMal_in: $ids, type: ANIME) { id idMal } }
+}`
+	ids := make(map[int]int, len(malIDs))
+	for start := 0; start < len(malIDs); start += 50 {
+		chunk := malIDs[start:min(start+50, len(malIDs))]
+
+		for page := 1; ; page++ {
+			var data struct {
+				Page struct {
+					PageInfo struct {
+						HasNextPage bool `json:"hasNextPage"`
+					} `json:"pageInfo"`
+					Media []struct {
+						ID    int `json:"id"`
+						IDMal int `json:"idMal"`
+					} `json:"media"`
+				} `json:"Page"`
+			}
+			if err := c.query(query, map[string]any{"ids": chunk, "page": page}, &data); err != nil {
+				return ids, err
+			}
+
+			for _, m := range data.Page.Media {
+				ids[m.IDMal] = m.ID
+			}
+			if !data.Page.PageInfo.HasNextPage {
+				break
+			}
+		}
+	}
+	return ids, nil
+}
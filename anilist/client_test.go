@@ -0,0 +1,193 @@
+package anilist
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"hianime-mpv-go/paths"
+	"hianime-mpv-go/state"
+)
+
+// standIn answers the GraphQL queries the client sends, the way AniList does.
+type standIn struct {
+	mu      sync.Mutex
+	down    bool // answer every mutation with a 500
+	saved   []Entry
+	entries []Entry // the list returned to MediaListCollection
+}
+
+func (s *standIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var req graphqlRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"data":null,"errors":[{"message":"Invalid token"}]}`))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var data any
+	switch {
+	case strings.Contains(req.Query, "SaveMediaListEntry"):
+		if s.down {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"data":null,"errors":[{"message":"Internal Server Error"}]}`))
+			return
+		}
+		entry := Entry{
+			MediaID:  int(req.Variables["mediaId"].(float64)),
+			Status:   req.Variables["status"].(string),
+			Progress: int(req.Variables["progress"].(float64)),
+		}
+		s.saved = append(s.saved, entry)
+		data = map[string]any{"SaveMediaListEntry": map[string]any{"id": 1}}
+	case strings.Contains(req.Query, "Viewer"):
+		data = map[string]any{"Viewer": map[string]any{"id": 7, "name": "tester"}}
+	case strings.Contains(req.Query, "MediaListCollection"):
+		if req.Variables["userId"] != float64(7) {
+			http.Error(w, "wrong user", http.StatusBadRequest)
+			return
+		}
+		data = map[string]any{"MediaListCollection": map[string]any{
+			"lists": []any{map[string]any{"entries": s.entries}},
+		}}
+	default:
+		http.Error(w, "unknown query", http.StatusBadRequest)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]any{"data": data})
+}
+
+func (s *standIn) setDown(down bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.down = down
+}
+
+func (s *standIn) sent() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Entry(nil), s.saved...)
+}
+
+// setup points the client at a stand-in and gives the test its own data directory.
+func setup(t *testing.T) (*standIn, *Client) {
+	t.Helper()
+	paths.DataDir = t.TempDir()
+	state.DefaultStore = &state.JSONStore{}
+	t.Cleanup(func() { paths.DataDir = "" })
+
+	api := &standIn{}
+	srv := httptest.NewServer(api)
+	t.Cleanup(srv.Close)
+
+	client := NewClient("secret")
+	client.Endpoint = srv.URL
+	client.HTTP = srv.Client()
+	return api, client
+}
+
+func TestSaveMediaListEntry(t *testing.T) {
+	api, client := setup(t)
+
+	entry := Entry{MediaID: 21, Status: StatusCurrent, Progress: 12}
+	if err := client.SaveMediaListEntry(entry); err != nil {
+		t.Fatal(err)
+	}
+	if got := api.sent(); len(got) != 1 || got[0] != entry {
+		t.Errorf("sent %+v, want %+v", got, entry)
+	}
+
+	client.Token = "wrong"
+	if err := client.SaveMediaListEntry(entry); err == nil || !strings.Contains(err.Error(), "Invalid token") {
+		t.Errorf("got %v, want the GraphQL error", err)
+	}
+}
+
+func TestPushQueuesAndFlushes(t *testing.T) {
+	api, client := setup(t)
+
+	api.setDown(true)
+	if err := client.Push(Entry{MediaID: 21, Status: StatusCurrent, Progress: 3}); err == nil {
+		t.Fatal("Push succeeded while AniList was down")
+	}
+	// A later update of the same anime replaces the queued one.
+	client.Push(Entry{MediaID: 21, Status: StatusCurrent, Progress: 4})
+	client.Push(Entry{MediaID: 5114, Status: StatusCompleted, Progress: 64})
+
+	queue, err := Queued()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queue) != 2 || queue[21].Progress != 4 {
+		t.Fatalf("queue %+v, want anime 21 at 4 and anime 5114", queue)
+	}
+
+	api.setDown(false)
+	sent, err := client.Flush()
+	if err != nil || sent != 2 {
+		t.Fatalf("Flush sent %d, %v; want 2", sent, err)
+	}
+	got := api.sent()
+	if len(got) != 2 || got[0].MediaID != 21 || got[0].Progress != 4 || got[1].MediaID != 5114 {
+		t.Errorf("sent %+v, want the queued updates in media id order", got)
+	}
+	if queue, _ := Queued(); len(queue) != 0 {
+		t.Errorf("queue %+v left after Flush", queue)
+	}
+
+	// With AniList back, Push sends straight away.
+	if err := client.Push(Entry{MediaID: 21, Status: StatusCurrent, Progress: 5}); err != nil {
+		t.Fatal(err)
+	}
+	if got := api.sent(); len(got) != 3 || got[2].Progress != 5 {
+		t.Errorf("sent %+v, want progress 5 last", got)
+	}
+}
+
+func TestPull(t *testing.T) {
+	api, client := setup(t)
+	api.entries = []Entry{
+		{MediaID: 21, Status: StatusCurrent, Progress: 3},
+		{MediaID: 5114, Status: StatusCompleted, Progress: 2},
+		{MediaID: 999, Status: StatusPlanning},
+	}
+
+	library := []state.History{
+		{AnimeID: "100", Url: "https://hianime.to/one-piece-100", AnilistID: "21"},
+		{AnimeID: "200", Url: "https://hianime.to/fma-brotherhood-200", AnilistID: "5114"},
+		{AnimeID: "300", Url: "https://hianime.to/naruto-300"},
+	}
+	if err := state.SaveHistory(library); err != nil {
+		t.Fatal(err)
+	}
+
+	matched, total, err := client.Pull()
+	if err != nil || matched != 2 || total != 3 {
+		t.Fatalf("Pull = %d, %d, %v; want 2 of 3", matched, total, err)
+	}
+
+	library, err = state.LoadHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	onePiece, fma, naruto := library[0], library[1], library[2]
+	if onePiece.GetStatus() != state.StatusWatching || !onePiece.Episode[3].Watched || onePiece.Episode[4].Watched {
+		t.Errorf("one piece: %+v, want watching through episode 3", onePiece)
+	}
+	if fma.GetStatus() != state.StatusCompleted || !fma.Episode[2].Watched {
+		t.Errorf("fma: %+v, want completed through episode 2", fma)
+	}
+	if len(naruto.Episode) != 0 || naruto.Status != "" {
+		t.Errorf("naruto: %+v, want untouched", naruto)
+	}
+}
@@ -0,0 +1,210 @@
+package anilist
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"hianime-mpv-go/state"
+)
+
+// Default is the client used by Track. It is set by Configure when the config has a token, nil disables syncing.
+var Default *Client
+
+// queueSetting is the store setting holding the updates that couldn't be sent, by media id.
+const queueSetting = "anilist_queue"
+
+func Configure(token string) {
+	Default = nil
+	if token != "" {
+		Default = NewClient(token)
+	}
+}
+
+// EntryFor builds the list entry of a library series. The progress is the highest finished episode.
+// It reports false when the series has no AniList id.
+func EntryFor(h state.History) (Entry, bool) {
+	mediaID, err := strconv.Atoi(h.AnilistID)
+	if err != nil || mediaID <= 0 {
+		return Entry{}, false
+	}
+
+	progress := 0
+	for num, prog := range h.Episode {
+		if prog.Finished() && num > progress {
+			progress = num
+		}
+	}
+
+	status := StatusCurrent
+	switch h.GetStatus() {
+	case state.StatusCompleted:
+		status = StatusCompleted
+	case state.StatusDropped:
+		status = StatusDropped
+	}
+
+	return Entry{MediaID: mediaID, Status: status, Progress: progress}, true
+}
+
+// Track sends the progress of h once episodeNum has been watched past the finished threshold.
+// When AniList can't be reached the update is queued and sent before the next one.
+func Track(h state.History, episodeNum int) error {
+	if Default == nil || !h.Episode[episodeNum].Finished() {
+		return nil
+	}
+
+	entry, ok := EntryFor(h)
+	if !ok {
+		return nil
+	}
+	return Default.Push(entry)
+}
+
+// Push sends the queued updates and then entry. Whatever couldn't be sent stays queued.
+func (c *Client) Push(entry Entry) error {
+	// The queue goes first, so an older progress never overwrites this one.
+	if _, err := c.Flush(); err != nil {
+		if qErr := enqueue(entry); qErr != nil {
+			return qErr
+		}
+		return fmt.Errorf("%w (update queued for retry)", err)
+	}
+
+	if err := c.SaveMediaListEntry(entry); err != nil {
+		if qErr := enqueue(entry); qErr != nil {
+			return qErr
+		}
+		return fmt.Errorf("%w (update queued for retry)", err)
+	}
+	return nil
+}
+
+// Flush sends the queued updates and returns how many were sent.
+func (c *Client) Flush() (int, error) {
+	queue, err := loadQueue()
+	if err != nil || len(queue) == 0 {
+		return 0, err
+	}
+
+	ids := make([]int, 0, len(queue))
+	for id := range queue {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+
+	sent := make(map[int]Entry)
+	for _, id := range ids {
+		if err := c.SaveMediaListEntry(queue[id]); err != nil {
+			if qErr := dequeue(sent); qErr != nil {
+				return len(sent), qErr
+			}
+			return len(sent), err
+		}
+		sent[id] = queue[id]
+	}
+	return len(sent), dequeue(sent)
+}
+
+// Queued returns the updates waiting to be sent.
+func Queued() (map[int]Entry, error) {
+	return loadQueue()
+}
+
+func loadQueue() (map[int]Entry, error) {
+	raw, _, err := state.DefaultStore.GetSetting(queueSetting)
+	if err != nil {
+		return make(map[int]Entry), err
+	}
+	return decodeQueue([]byte(raw))
+}
+
+func decodeQueue(raw []byte) (map[int]Entry, error) {
+	queue := make(map[int]Entry)
+	if len(raw) == 0 {
+		return queue, nil
+	}
+	if err := json.Unmarshal(raw, &queue); err != nil {
+		return queue, fmt.Errorf("Failed to decode the AniList queue: %w", err)
+	}
+	return queue, nil
+}
+
+// editQueue applies edit to the stored queue in one transaction, so sessions queueing at the same time keep
+// each other's updates.
+func editQueue(edit func(queue map[int]Entry)) error {
+	return state.DefaultStore.UpdateSetting(queueSetting, func(raw []byte) ([]byte, error) {
+		queue, err := decodeQueue(raw)
+		if err != nil {
+			return nil, err
+		}
+		edit(queue)
+		return json.Marshal(queue)
+	})
+}
+
+// enqueue keeps only the latest update of every anime.
+func enqueue(entry Entry) error {
+	return editQueue(func(queue map[int]Entry) {
+		queue[entry.MediaID] = entry
+	})
+}
+
+// dequeue removes the updates that were sent, unless a newer one was queued meanwhile.
+func dequeue(sent map[int]Entry) error {
+	if len(sent) == 0 {
+		return nil
+	}
+	return editQueue(func(queue map[int]Entry) {
+		for id, entry := range sent {
+			if queue[id] == entry {
+				delete(queue, id)
+			}
+		}
+	})
+}
+
+// Pull seeds the library from the user's AniList list. Series with a matching AniList id take its status,
+// and the episodes up to its progress count as watched. It returns how many list entries matched a series, out of how many.
+func (c *Client) Pull() (int, int, error) {
+	viewer, err := c.Viewer()
+	if err != nil {
+		return 0, 0, err
+	}
+	entries, err := c.List(viewer.ID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	byMedia := make(map[string]Entry, len(entries))
+	for _, e := range entries {
+		byMedia[strconv.Itoa(e.MediaID)] = e
+	}
+
+	matched := 0
+	_, err = state.UpdateLibrary(func(library []state.History) ([]state.History, error) {
+		for i := range library {
+			if e, ok := byMedia[library[i].AnilistID]; ok {
+				applyEntry(&library[i], e)
+				matched++
+			}
+		}
+		return library, nil
+	})
+	return matched, len(entries), err
+}
+
+func applyEntry(h *state.History, e Entry) {
+	switch e.Status {
+	case StatusCurrent, StatusRepeating, StatusPaused:
+		h.Status = state.StatusWatching
+	case StatusCompleted:
+		h.Status = state.StatusCompleted
+	case StatusDropped:
+		h.Status = state.StatusDropped
+	}
+
+	h.MarkWatchedThrough(e.Progress, time.Now())
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+
+	"hianime-mpv-go/config"
+	"hianime-mpv-go/hianime"
+	"hianime-mpv-go/state"
+	"hianime-mpv-go/ui"
+	"hianime-mpv-go/updates"
+)
+
+func cmdCheck(args []string, history []state.History, configSession config.Settings) error {
+	fs := newFlagSet("check")
+	workers := fs.Int("workers", updates.DefaultWorkers, "How many series to check at the same time")
+
+	positional, err := parseInterleaved(fs, args)
+	if err != nil || len(positional) != 0 {
+		return errUsage
+	}
+
+	followed := updates.Followed(history)
+	if len(followed) == 0 {
+		return fmt.Errorf("No series being watched to check")
+	}
+	results := checkSeries(followed, *workers)
+
+	if ui.Output != ui.OutputText {
+		return ui.PrintRecords("check_result", results)
+	}
+	ui.PrintNewEpisodes(results)
+
+	for _, r := range results {
+		if r.Err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("Every check failed")
+}
+
+// checkSeries fetches the episode lists and remembers the counts for the next check.
+func checkSeries(followed []state.History, workers int) []updates.Result {
+	fmt.Printf("--> Checking %d series for new episodes...\n", len(followed))
+	results := updates.Check(followed, workers, hianime.FetchEpisodes)
+
+	if _, err := updates.Record(results); err != nil {
+		fmt.Println("Failed to save the episode counts: " + err.Error())
+	}
+	return results
+}
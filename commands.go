@@ -0,0 +1,507 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"hianime-mpv-go/anilist"
+	"hianime-mpv-go/config"
+	"hianime-mpv-go/hianime"
+	"hianime-mpv-go/player"
+	"hianime-mpv-go/state"
+	"hianime-mpv-go/ui"
+)
+
+// Exit codes returned by the subcommands.
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 2
+)
+
+var errUsage = errors.New("usage")
+
+type command struct {
+	name    string
+	usage   string
+	summary string
+	run     func(args []string, history []state.History, configSession config.Settings) error
+}
+
+var commands = []command{
+	{"search", "search <query>", "Search hianime and list the results", cmdSearch},
+	{"episodes", "episodes <url>", "List the episodes of a series", cmdEpisodes},
+	{"play", "play <url> [--episode SEL] [--server NAME] [--audio TYPE] [--resume MODE]", "Play episodes, e.g. --episode next or 3-7 (defaults to the last watched one)", cmdPlay},
+	{"continue", "continue [--server NAME] [--audio TYPE] [--resume MODE]", "Resume the most recent history entry", cmdContinue},
+	{"servers", "servers <url> [--episode SEL] | servers stats", "List the servers of an episode, or how reliable each server has been", cmdServers},
+	{"resolve", "resolve <url> [--episode SEL] [--server NAME] [--audio TYPE]", "Print the stream url and tracks without playing", cmdResolve},
+	{"history", "history", "List the recent history", cmdHistory},
+	{"library", "library [list|status|archive|mark|unmark|lang] ...", "Browse every series ever watched, see 'library help'", cmdLibrary},
+	{"check", "check [--workers N]", "Check the series being watched for new episodes", cmdCheck},
+	{"anilist", "anilist [login|status|pull|sync]", "Sync progress with AniList, see 'anilist help'", cmdAnilist},
+	{"watch", "watch [--interval D] [--jitter D] [--once]", "Keep checking for new episodes and run the hooks from the watch config", cmdWatch},
+	{"watchlist", "watchlist [list|add|remove|move|promote] ...", "Series saved to watch later, see 'watchlist help'", cmdWatchlist},
+	{"stats", "stats [--period day|week|month] [--limit N] [--csv TABLE]", "Report how much was watched, per period and per series", cmdStats},
+	{"config", "config [show]", "Print the effective settings and where they come from, see 'config help'", cmdConfig},
+	{"sync", "sync", "Exchange history changes with the other devices through the sync folder", cmdSync},
+	{"profile", "profile [list|add|remove] ...", "Profiles with their own history and settings, see 'profile help'", cmdProfile},
+	{"mal", "mal [export|import] ...", "Export or import the history as a MyAnimeList list, see 'mal help'", cmdMal},
+}
+
+func findCommand(name string) (command, bool) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, true
+		}
+	}
+	return command{}, false
+}
+
+func printUsage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage: %s [flags] [command]\n\n", os.Args[0])
+	fmt.Fprintln(out, "Without a command the interactive menu is started.")
+	fmt.Fprintln(out, "\nCommands:")
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-72s %s\n", c.usage, c.summary)
+	}
+	fmt.Fprintln(out, "\nFlags:")
+	flag.PrintDefaults()
+}
+
+// runCommand executes a subcommand and returns the process exit code.
+func runCommand(c command, args []string, history []state.History, configSession config.Settings) int {
+	err := c.run(args, history, configSession)
+	os.Stdout = stdout
+
+	if errors.Is(err, errUsage) {
+		fmt.Fprintf(os.Stderr, "Usage: %s %s\n", os.Args[0], c.usage)
+		return exitUsage
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return exitFailure
+	}
+	return exitOK
+}
+
+// stdout is the real standard output. In JSON mode os.Stdout points at stderr while a command runs, so only records reach stdout.
+var stdout = os.Stdout
+
+func useOutput(format ui.OutputFormat) {
+	ui.Output = format
+	if format != ui.OutputText {
+		os.Stdout = os.Stderr
+	}
+}
+
+// newFlagSet creates the flags of a subcommand, including the output flags so they also work after the command name.
+func newFlagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	registerOutputFlags(fs)
+	return fs
+}
+
+type outputFlag ui.OutputFormat
+
+func (o outputFlag) IsBoolFlag() bool { return true }
+func (o outputFlag) String() string   { return "false" }
+func (o outputFlag) Set(value string) error {
+	if value == "true" {
+		useOutput(ui.OutputFormat(o))
+	}
+	return nil
+}
+
+func registerOutputFlags(fs *flag.FlagSet) {
+	fs.Var(outputFlag(ui.OutputJSON), "json", "Print results as JSON")
+	fs.Var(outputFlag(ui.OutputNDJSON), "ndjson", "Print results as newline delimited JSON, one record per line")
+}
+
+// parseInterleaved lets flags appear after positional arguments, e.g. `play <url> --episode 3`.
+func parseInterleaved(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, errUsage
+		}
+		if fs.NArg() == 0 {
+			return positional, nil
+		}
+		positional = append(positional, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+func cmdSearch(args []string, history []state.History, configSession config.Settings) error {
+	positional, err := parseInterleaved(newFlagSet("search"), args)
+	if err != nil || len(positional) == 0 {
+		return errUsage
+	}
+
+	searchData, err := hianime.Search(strings.Join(positional, " "))
+	if err != nil {
+		return err
+	}
+	if len(searchData) == 0 {
+		return fmt.Errorf("No anime result found")
+	}
+
+	if ui.Output != ui.OutputText {
+		return ui.PrintRecords("search_result", searchData)
+	}
+	ui.PrintSeries(searchData)
+	return nil
+}
+
+func cmdEpisodes(args []string, history []state.History, configSession config.Settings) error {
+	positional, err := parseInterleaved(newFlagSet("episodes"), args)
+	if err != nil || len(positional) != 1 {
+		return errUsage
+	}
+
+	seriesMetadata, err := hianime.FetchSeriesData(positional[0])
+	if err != nil {
+		return fmt.Errorf("Failed to load the series: %w", err)
+	}
+	if seriesMetadata.AnimeID == "" {
+		return fmt.Errorf("Couldn't find series data for %s", positional[0])
+	}
+	episodes, err := hianime.FetchEpisodes(seriesMetadata.AnimeID)
+	if err != nil {
+		return fmt.Errorf("Failed to load the episodes: %w", err)
+	}
+	if len(episodes) == 0 {
+		return fmt.Errorf("No episodes found for %s", positional[0])
+	}
+
+	if ui.Output != ui.OutputText {
+		return ui.PrintRecords("episode", episodes)
+	}
+	historySelect, _ := state.FindHistory(history, seriesMetadata)
+	ui.PrintEpisodes(episodes, historySelect)
+	return nil
+}
+
+func cmdServers(args []string, history []state.History, configSession config.Settings) error {
+	if len(args) > 0 && args[0] == "stats" {
+		return serverStats(args[1:])
+	}
+
+	fs := newFlagSet("servers")
+	episodeSel := fs.String("episode", "", "Episode: number, next, prev, last, latest or /keyword (defaults to the last watched episode)")
+
+	positional, err := parseInterleaved(fs, args)
+	if err != nil || len(positional) != 1 {
+		return errUsage
+	}
+
+	selectedEpisode, err := selectEpisode(positional[0], *episodeSel, history)
+	if err != nil {
+		return err
+	}
+
+	servers := hianime.GetEpisodeServerId(selectedEpisode.Id)
+	if len(servers) == 0 {
+		return fmt.Errorf("No available servers found.")
+	}
+
+	if ui.Output != ui.OutputText {
+		return ui.PrintRecords("server", servers)
+	}
+	ui.PrintServers(servers)
+	return nil
+}
+
+func cmdResolve(args []string, history []state.History, configSession config.Settings) error {
+	fs := newFlagSet("resolve")
+	episodeSel := fs.String("episode", "", "Episode: number, next, prev, last, latest or /keyword (defaults to the last watched episode)")
+	serverName := fs.String("server", "", "Server name, e.g. HD-1 (defaults to the first working server)")
+	audioType := fs.String("audio", "", "Try servers of this type first: sub, dub or raw (defaults to the audio_types config)")
+
+	positional, err := parseInterleaved(fs, args)
+	if err != nil || len(positional) != 1 {
+		return errUsage
+	}
+
+	_, historySelect, selected, err := selectEpisodes(positional[0], *episodeSel, history)
+	if err != nil {
+		return err
+	}
+	if len(selected) != 1 {
+		return fmt.Errorf("Select a single episode, got %d", len(selected))
+	}
+	selectedEpisode := selected[0]
+
+	if err := setAudio(&historySelect, *audioType); err != nil {
+		return err
+	}
+	servers, err := episodeServers(selectedEpisode, *serverName, configSession, historySelect)
+	if err != nil {
+		return err
+	}
+
+	for _, server := range servers {
+		streamData, err := player.Resolve(server)
+		if err != nil {
+			continue
+		}
+
+		if ui.Output != ui.OutputText {
+			return ui.PrintRecord("stream", resolvedStream{Episode: selectedEpisode, Server: server, Stream: streamData})
+		}
+		ui.PrintStream(server, streamData)
+		return nil
+	}
+
+	return fmt.Errorf("No available servers found for following episode.")
+}
+
+// serverStats prints what past attempts tell about every server, the most reliable first.
+func serverStats(args []string) error {
+	positional, err := parseInterleaved(newFlagSet("servers stats"), args)
+	if err != nil || len(positional) != 0 {
+		return errUsage
+	}
+
+	stats, err := state.LoadServerStats()
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	records := make([]serverStatsRecord, 0, len(stats))
+	for _, s := range stats {
+		records = append(records, serverStatsRecord{ServerStats: s, Score: s.Score(now), AverageFirstFrame: s.AverageFirstFrame()})
+	}
+	sort.Slice(records, func(a, b int) bool {
+		if records[a].Score != records[b].Score {
+			return records[a].Score > records[b].Score
+		}
+		return records[a].Name < records[b].Name
+	})
+
+	if ui.Output != ui.OutputText {
+		return ui.PrintRecords("server_stats", records)
+	}
+	if len(records) == 0 {
+		fmt.Println("--! No server tried yet")
+		return nil
+	}
+	rows := make([]state.ServerStats, len(records))
+	for i, r := range records {
+		rows[i] = r.ServerStats
+	}
+	ui.PrintServerStats(rows, now)
+	return nil
+}
+
+// serverStatsRecord is the "server_stats" record: the statistics of a server with its current score.
+type serverStatsRecord struct {
+	state.ServerStats
+	Score             float64 `json:"score"`
+	AverageFirstFrame float64 `json:"average_first_frame"`
+}
+
+// resolvedStream is the "stream" record: the stream together with the episode and server it was resolved from.
+type resolvedStream struct {
+	Episode hianime.Episodes   `json:"episode"`
+	Server  hianime.ServerList `json:"server"`
+	Stream  hianime.StreamData `json:"stream"`
+}
+
+func cmdPlay(args []string, history []state.History, configSession config.Settings) error {
+	fs := newFlagSet("play")
+	episodeSel := fs.String("episode", "", "Episodes: number, next, prev, last, latest, range like 3-7 or /keyword (defaults to the last watched episode)")
+	serverName := fs.String("server", "", "Server name, e.g. HD-1 (defaults to trying every server)")
+	resume := fs.String("resume", "", "Where an episode left halfway starts: resume, start or intro (defaults to the resume config)")
+	audioType := fs.String("audio", "", "Try servers of this type first and remember it for the series: sub, dub or raw")
+
+	positional, err := parseInterleaved(fs, args)
+	if err != nil || len(positional) != 1 {
+		return errUsage
+	}
+	if err := setResume(&configSession, *resume); err != nil {
+		return err
+	}
+
+	return playEpisodes(positional[0], *episodeSel, *serverName, *audioType, history, configSession)
+}
+
+func cmdContinue(args []string, history []state.History, configSession config.Settings) error {
+	fs := newFlagSet("continue")
+	serverName := fs.String("server", "", "Server name, e.g. HD-1 (defaults to trying every server)")
+	resume := fs.String("resume", "", "Where an episode left halfway starts: resume, start or intro (defaults to the resume config)")
+	audioType := fs.String("audio", "", "Try servers of this type first and remember it for the series: sub, dub or raw")
+
+	positional, err := parseInterleaved(fs, args)
+	if err != nil || len(positional) != 0 {
+		return errUsage
+	}
+	if err := setResume(&configSession, *resume); err != nil {
+		return err
+	}
+	recent := state.Recent(history, 1)
+	if len(recent) == 0 {
+		return fmt.Errorf("No recent history found")
+	}
+
+	return playEpisodes(recent[0].Url, "", *serverName, *audioType, history, configSession)
+}
+
+// setResume overrides the resume config with the --resume flag. Commands can't ask, so "ask" resumes.
+func setResume(configSession *config.Settings, mode string) error {
+	if mode == "" {
+		return nil
+	}
+	if !slices.Contains(player.ResumeModes, mode) {
+		return fmt.Errorf("Unknown resume mode '%s', use one of %s", mode, strings.Join(player.ResumeModes, ", "))
+	}
+	configSession.Resume = mode
+	return nil
+}
+
+// setAudio sets the server type a series tries first from the --audio flag.
+func setAudio(historySelect *state.History, audioType string) error {
+	if audioType == "" {
+		return nil
+	}
+	if !slices.Contains(config.AudioTypes, audioType) {
+		return fmt.Errorf("Unknown audio type '%s', use one of %s", audioType, strings.Join(config.AudioTypes, ", "))
+	}
+	historySelect.AudioType = audioType
+	return nil
+}
+
+func cmdHistory(args []string, history []state.History, configSession config.Settings) error {
+	positional, err := parseInterleaved(newFlagSet("history"), args)
+	if err != nil || len(positional) != 0 {
+		return errUsage
+	}
+
+	recent := state.Recent(history, state.RecentLimit)
+	if ui.Output != ui.OutputText {
+		return ui.PrintRecords("history", recent)
+	}
+	ui.PrintHistory(recent)
+	return nil
+}
+
+// selectEpisodes opens a series and resolves the episode selection the same way the menu prompt does.
+func selectEpisodes(url string, selection string, history []state.History) (hianime.SeriesData, state.History, []hianime.Episodes, error) {
+	seriesMetadata, err := hianime.FetchSeriesData(url)
+	if err != nil {
+		return seriesMetadata, state.History{}, nil, fmt.Errorf("Failed to load the series: %w", err)
+	}
+	if seriesMetadata.AnimeID == "" {
+		return seriesMetadata, state.History{}, nil, fmt.Errorf("Couldn't find series data for %s", url)
+	}
+
+	historySelect, exists := state.FindHistory(history, seriesMetadata)
+	if !exists {
+		historySelect = state.NewHistory(seriesMetadata)
+	}
+
+	episodes, err := hianime.FetchEpisodes(seriesMetadata.AnimeID)
+	if err != nil {
+		return seriesMetadata, historySelect, nil, fmt.Errorf("Failed to load the episodes: %w", err)
+	}
+	queue, err := parseEpisodeSelection(selection, episodes, historySelect)
+	if err != nil {
+		return seriesMetadata, historySelect, nil, err
+	}
+
+	selected := make([]hianime.Episodes, 0, len(queue))
+	for _, num := range queue {
+		selected = append(selected, episodes[num-1])
+	}
+
+	return seriesMetadata, historySelect, selected, nil
+}
+
+// selectEpisode is selectEpisodes for commands that work on a single episode.
+func selectEpisode(url string, selection string, history []state.History) (hianime.Episodes, error) {
+	_, _, selected, err := selectEpisodes(url, selection, history)
+	if err != nil {
+		return hianime.Episodes{}, err
+	}
+	if len(selected) != 1 {
+		return hianime.Episodes{}, fmt.Errorf("Select a single episode, got %d", len(selected))
+	}
+	return selected[0], nil
+}
+
+// episodeServers returns the servers of an episode in the order to try them, only those named serverName if set.
+func episodeServers(episode hianime.Episodes, serverName string, configSession config.Settings, historySelect state.History) ([]hianime.ServerList, error) {
+	servers := player.OrderServers(hianime.GetEpisodeServerId(episode.Id), configSession, historySelect)
+	if serverName == "" {
+		return servers, nil
+	}
+
+	servers = filterServers(servers, serverName)
+	if len(servers) == 0 {
+		return nil, fmt.Errorf("Server '%s' isn't available for episode %d", serverName, episode.Number)
+	}
+	return servers, nil
+}
+
+// playEpisodes is the scripted version of the menu flow: open the series, pick the episodes and server, play them in order and save progress.
+// audioType, when set, is tried first and remembered for the series.
+func playEpisodes(url string, selection string, serverName string, audioType string, history []state.History, configSession config.Settings) error {
+	seriesMetadata, historySelect, queue, err := selectEpisodes(url, selection, history)
+	if err != nil {
+		return err
+	}
+	if err := setAudio(&historySelect, audioType); err != nil {
+		return err
+	}
+
+	for i, selectedEpisode := range queue {
+		servers, err := episodeServers(selectedEpisode, serverName, configSession, historySelect)
+		if err != nil {
+			return err
+		}
+
+		historySelect.LastEpisode = selectedEpisode.Number
+		if _, err := state.SaveSeries(historySelect); err != nil {
+			return err
+		}
+		result, err := player.PlayServers(servers, seriesMetadata, selectedEpisode, historySelect, configSession)
+		if err != nil {
+			return err
+		}
+
+		historySelect.RecordProgress(selectedEpisode.Number, result.Position, result.Duration, result.OutroStart, result.SubDelay, result.Volume)
+		if _, err := state.SaveSeries(historySelect); err != nil {
+			return err
+		}
+		if err := state.AddSession(result.Session(historySelect, selectedEpisode.Number)); err != nil {
+			fmt.Println("--! Failed to record the viewing session: " + err.Error())
+		}
+		if err := anilist.Track(historySelect, selectedEpisode.Number); err != nil {
+			fmt.Println("--! AniList sync failed: " + err.Error())
+		}
+
+		if !historySelect.Episode[selectedEpisode.Number].Finished() && i < len(queue)-1 {
+			fmt.Println("\n--> Episode wasn't finished. Stopping the queue.")
+			break
+		}
+	}
+
+	return nil
+}
+
+func filterServers(servers []hianime.ServerList, name string) []hianime.ServerList {
+	var filtered []hianime.ServerList
+	for _, s := range servers {
+		if strings.EqualFold(strings.TrimSpace(s.Name), name) {
+			filtered = append(filtered, s)
+		}
+	}
+	return filtered
+}
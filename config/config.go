@@ -3,65 +3,146 @@ package config
 import (
 	"encoding/json"
 	"fmt"
-	"os"
+
+	"hianime-mpv-go/safefile"
 )
 
 var FileName string = "config.json"
 var DebugMode bool
 
 type Settings struct {
-	JimakuEnable     bool   `json:"jimaku_enable"`     // for enabling jimaku
-	AutoSelectServer bool   `json:"auto_selectserver"` // whether user want use auto select server or manual input server
-	MpvPath          string `json:"mpv_path"`          // manually set mpv path command
-	EnglishOnly      bool   `json:"english_only"`      // whether user want importing english subtitle only or not into mpv
+	SchemaVersion    int             `json:"schema_version"`    // version of this file's layout, upgraded on load
+	JimakuEnable     bool            `json:"jimaku_enable"`     // for enabling jimaku
+	AutoSelectServer bool            `json:"auto_selectserver"` // whether user want use auto select server or manual input server
+	MpvPath          string          `json:"mpv_path"`          // manually set mpv path command
+	EnglishOnly      bool            `json:"english_only"`      // whether user want importing english subtitle only or not into mpv
+	AudioTypes       []string        `json:"audio_types"`       // servers to try first, by type: "sub", "dub" or "raw"
+	SubLanguages     []string        `json:"sub_languages"`     // subtitles to load, most wanted first, e.g. ["English", "es"]; overrides english_only
+	Selector         string          `json:"selector"`          // fuzzy finder for picking series/episodes: "", "auto", "fzf", "sk" or "builtin"
+	Storage          string          `json:"storage"`           // where history is kept: "bolt" (state/history.db) or "json" (state/history.json)
+	CheckOnStartup   bool            `json:"check_on_startup"`  // check the series being watched for new episodes when the menu starts
+	WatchedThreshold float64         `json:"watched_threshold"` // fraction of an episode after which it counts as watched, 0.9 when unset
+	Resume           string          `json:"resume"`            // where an episode left halfway starts: "ask", "resume", "start" or "intro"
+	Watch            WatchSettings   `json:"watch"`             // the `watch` command
+	Anilist          AnilistSettings `json:"anilist"`           // progress sync with AniList
+	Sync             SyncSettings    `json:"sync"`              // history sync with other machines through a shared folder
+	BaseURL          string          `json:"base_url"`          // hianime site to scrape, e.g. a mirror
+	Timeout          string          `json:"timeout"`           // limit of every request to hianime and Jimaku, e.g. "30s"
+	JimakuAPIKey     string          `json:"jimaku_api_key"`    // key of the Jimaku API, also read from JIMAKU_API_KEY
+	JimakuURL        string          `json:"jimaku_url"`        // Jimaku site to query
+	DataDir          string          `json:"data_dir"`          // directory for history and other state, empty for the XDG one
+	CacheDir         string          `json:"cache_dir"`         // directory for downloaded subtitles, empty for the XDG one
+	DecryptKey       string          `json:"decrypt_key"`       // passphrase of encrypted sources (HD-3), fetched from decrypt_key_url when empty
+	DecryptKeyURL    string          `json:"decrypt_key_url"`   // url serving the passphrase of encrypted sources as plain text, off when empty
+
+	// Profiles holds, by profile name, the settings each profile overrides, laid out like the rest of this file.
+	Profiles map[string]json.RawMessage `json:"profiles,omitempty"`
+
+	sources  map[string]string // where each setting that isn't a default comes from, by key
+	problems []error           // keys of the file that couldn't be read
 }
 
-func LoadConfig() (Settings, error) {
-	var configSession Settings
+// AnilistSettings holds the AniList OAuth token. Syncing is on while Token is set.
+type AnilistSettings struct {
+	ClientID string `json:"client_id"` // id of the AniList API client used by `anilist login`
+	Token    string `json:"token"`     // access token, filled in by `anilist login`
+}
 
-	if _, err := os.Stat(FileName); err == nil {
-		fmt.Println("File config load success.")
-		jsonData, err := os.ReadFile(FileName)
-		if err != nil {
-			return configSession, fmt.Errorf("Failed to open json files: %w", err)
-		}
+// SyncSettings configures the history sync. Syncing is on while Folder is set.
+type SyncSettings struct {
+	Folder string `json:"folder"` // folder shared by the machines, e.g. one synced by Syncthing or Dropbox
+	Device string `json:"device"` // name of this machine's log in the folder, the hostname when empty
+}
 
-		if err = json.Unmarshal(jsonData, &configSession); err != nil {
-			return configSession, fmt.Errorf("Failed to convert to struct: %w", err)
-		}
+// WatchSettings configures the polling of `watch` and what it does when new episodes are found.
+type WatchSettings struct {
+	Interval   string `json:"interval"`    // time between checks, e.g. "30m"
+	Jitter     string `json:"jitter"`      // random delay of up to this much added to every interval
+	Command    string `json:"command"`     // shell command run for every series with new episodes
+	WebhookURL string `json:"webhook_url"` // url receiving a JSON POST for every series with new episodes
+	Notify     bool   `json:"notify"`      // show a desktop notification
+	Download   bool   `json:"download"`    // queue the new episodes for download
+}
 
-	} else if os.IsNotExist(err) {
-		_, err := os.Create(FileName)
+// SchemaVersion is the current schema_version of the config file.
+//
+//	1: no schema_version field
+//	2: schema_version added
+//	3: every setting present, missing ones added with their default
+const SchemaVersion = 3
 
-		configSession = Settings{
-			JimakuEnable:     true,
-			AutoSelectServer: true,
-			MpvPath:          "",
-			EnglishOnly:      true,
-		}
+var configSchema = safefile.Schema{
+	Current: SchemaVersion,
+	Migrations: map[int]safefile.Migration{
+		1: func(data []byte) ([]byte, error) { return safefile.SetVersion(data, 2) },
+		2: addDefaults,
+	},
+}
 
-		SaveConfig(configSession)
+func defaultConfig() Settings {
+	return Settings{
+		SchemaVersion:    SchemaVersion,
+		JimakuEnable:     true,
+		AutoSelectServer: true,
+		MpvPath:          "",
+		EnglishOnly:      true,
+		Storage:          "bolt",
+		WatchedThreshold: 0.9,
+		BaseURL:          "https://hianime.to",
+		Timeout:          "30s",
+		JimakuURL:        "https://jimaku.cc",
+	}
+}
+
+// LoadConfig reads the config file over the defaults. Unknown keys and values of the wrong type are left out and
+// reported by Problems. The environment and flags are applied by the caller with ApplyEnv and ApplyFlags, so the
+// settings can be saved back without them.
+func LoadConfig() (Settings, error) {
+	var configSession Settings
 
+	err := safefile.WithLock(FileName, func() error {
+		exists, err := safefile.Load(FileName, configSchema, func(data []byte) error {
+			configSession = defaultConfig()
+			if err := configSession.decodeStrict(data); err != nil {
+				return err
+			}
+			configSession.markSources(data, SourceFile)
+			return nil
+		})
 		if err != nil {
-			return configSession, fmt.Errorf("Failed to create history json file: %w", err)
+			return err
 		}
-	} else {
-		return configSession, fmt.Errorf("Error accessing path %s: %w\n", FileName, err)
-	}
 
-	return configSession, nil
+		if exists {
+			if DebugMode {
+				fmt.Println("File config load success.")
+			}
+			return nil
+		}
+
+		configSession = defaultConfig()
+		return writeConfig(configSession)
+	})
+
+	return configSession, err
 }
 
 func SaveConfig(rawData Settings) error {
+	rawData.SchemaVersion = SchemaVersion
+	return safefile.WithLock(FileName, func() error {
+		return writeConfig(rawData)
+	})
+}
+
+func writeConfig(rawData Settings) error {
 	jsonData, err := json.MarshalIndent(rawData, "", " ")
 	if err != nil {
-		return fmt.Errorf("Failed to save the history files: %w", err)
+		return fmt.Errorf("Failed to save the config file: %w", err)
 	}
 
-	if err = os.WriteFile(FileName, jsonData, os.ModePerm); err != nil {
-		return fmt.Errorf("Failed to write history files: %w", err)
+	if err = safefile.Write(FileName, jsonData); err != nil {
+		return fmt.Errorf("Failed to write config file: %w", err)
 	}
 
 	return nil
-
 }
@@ -0,0 +1,248 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Where the value of a setting comes from, from the lowest precedence to the highest.
+// A profile's overrides are reported as SourceProfile plus the profile name.
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceProfile = "profile"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// EnvPrefix starts the name of the environment variable of every setting, see EnvName.
+const EnvPrefix = "HIANIME_"
+
+// legacyEnv are variables read by older versions, used when the HIANIME_ one isn't set.
+var legacyEnv = map[string]string{
+	"jimaku_api_key": "JIMAKU_API_KEY",
+}
+
+// secretKeys are shown masked by `config show`.
+var secretKeys = map[string]bool{
+	"jimaku_api_key": true,
+	"anilist.token":  true,
+	"decrypt_key":    true,
+}
+
+// Keys returns the key of every setting, nested ones joined with dots like "watch.interval", in file order.
+// The schema version and the profiles aren't settings.
+func Keys() []string {
+	var keys []string
+	walkFields(reflect.TypeOf(Settings{}), "", func(key string, _ []int) {
+		keys = append(keys, key)
+	})
+	return keys
+}
+
+// EnvName returns the environment variable overriding a setting, e.g. HIANIME_WATCH_INTERVAL for "watch.interval".
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// IsSecret reports whether the value of a setting shouldn't be printed.
+func IsSecret(key string) bool {
+	return secretKeys[key]
+}
+
+// IsBool reports whether a setting is true or false.
+func IsBool(key string) bool {
+	var s Settings
+	v, ok := s.field(key)
+	return ok && v.Kind() == reflect.Bool
+}
+
+func walkFields(t reflect.Type, prefix string, visit func(key string, index []int)) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if !field.IsExported() || name == "" || name == "-" || name == "schema_version" || name == "profiles" {
+			continue
+		}
+
+		key := prefix + name
+		if field.Type.Kind() == reflect.Struct {
+			walkFields(field.Type, key+".", func(sub string, index []int) {
+				visit(sub, append([]int{i}, index...))
+			})
+			continue
+		}
+		visit(key, []int{i})
+	}
+}
+
+func (s *Settings) field(key string) (reflect.Value, bool) {
+	var found reflect.Value
+	walkFields(reflect.TypeOf(*s), "", func(k string, index []int) {
+		if k == key {
+			found = reflect.ValueOf(s).Elem().FieldByIndex(index)
+		}
+	})
+	return found, found.IsValid()
+}
+
+// Get returns the value of a setting as text.
+func (s Settings) Get(key string) (string, bool) {
+	v, ok := s.field(key)
+	if !ok {
+		return "", false
+	}
+	if list, ok := v.Interface().([]string); ok {
+		return strings.Join(list, ","), true
+	}
+	return fmt.Sprint(v.Interface()), true
+}
+
+// Set parses value for a setting and records source as where it came from.
+func (s *Settings) Set(key, value, source string) error {
+	v, ok := s.field(key)
+	if !ok {
+		return fmt.Errorf("Unknown setting '%s'", key)
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("Invalid value '%s' for %s, expected true or false", value, key)
+		}
+		v.SetBool(b)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("Invalid value '%s' for %s, expected a whole number", value, key)
+		}
+		v.SetInt(int64(n))
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("Invalid value '%s' for %s, expected a number", value, key)
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		// Lists are given comma separated, e.g. "sub,dub".
+		var list []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				list = append(list, item)
+			}
+		}
+		v.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("Setting '%s' can't be set from text", key)
+	}
+
+	s.setSource(key, source)
+	return nil
+}
+
+// Source returns where the value of a setting comes from.
+func (s Settings) Source(key string) string {
+	if source, ok := s.sources[key]; ok {
+		return source
+	}
+	return SourceDefault
+}
+
+// setSource copies the sources before changing them, settings are passed around by value.
+func (s *Settings) setSource(key, source string) {
+	sources := make(map[string]string, len(s.sources)+1)
+	for k, v := range s.sources {
+		sources[k] = v
+	}
+	sources[key] = source
+	s.sources = sources
+}
+
+// markSources records source for the settings present in a JSON object laid out like the config file.
+func (s *Settings) markSources(data []byte, source string) {
+	var raw map[string]any
+	if json.Unmarshal(data, &raw) != nil {
+		return
+	}
+	present := make(map[string]bool)
+	flattenKeys(raw, "", present)
+
+	for _, key := range Keys() {
+		if present[key] {
+			s.setSource(key, source)
+		}
+	}
+}
+
+func flattenKeys(raw map[string]any, prefix string, present map[string]bool) {
+	for name, value := range raw {
+		if nested, ok := value.(map[string]any); ok {
+			flattenKeys(nested, prefix+name+".", present)
+			continue
+		}
+		present[prefix+name] = true
+	}
+}
+
+// ApplyEnv overrides the settings with the HIANIME_* environment variables that are set, see EnvName.
+func (s *Settings) ApplyEnv() error {
+	for _, key := range Keys() {
+		name := EnvName(key)
+		value, ok := os.LookupEnv(name)
+		if (!ok || value == "") && legacyEnv[key] != "" {
+			name = legacyEnv[key]
+			value, ok = os.LookupEnv(name)
+		}
+		if !ok || value == "" {
+			continue
+		}
+
+		if err := s.Set(key, value, SourceEnv+" "+name); err != nil {
+			return fmt.Errorf("Failed to read %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// ApplyFlags overrides the settings with "key=value" pairs given on the command line, in order.
+func (s *Settings) ApplyFlags(pairs []string) error {
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("Invalid setting '%s', expected key=value", pair)
+		}
+		if err := s.Set(strings.TrimSpace(key), value, SourceFlag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Entry is one setting as printed by `config show`.
+type Entry struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+	Env    string `json:"env"`
+}
+
+// Effective returns every setting with its value and where it comes from. Secrets are masked.
+func (s Settings) Effective() []Entry {
+	keys := Keys()
+	entries := make([]Entry, 0, len(keys))
+	for _, key := range keys {
+		value, _ := s.Get(key)
+		if IsSecret(key) && value != "" {
+			value = "********"
+		}
+		entries = append(entries, Entry{Key: key, Value: value, Source: s.Source(key), Env: EnvName(key)})
+	}
+	return entries
+}
@@ -0,0 +1,87 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+)
+
+// DefaultProfile names the profile without overrides, whose state is in the data directory itself.
+const DefaultProfile = "default"
+
+var profileName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ValidProfileName checks that name can be used as a directory name and isn't the default profile.
+func ValidProfileName(name string) error {
+	if name == DefaultProfile || !profileName.MatchString(name) {
+		return fmt.Errorf("Invalid profile name '%s', use letters, digits, '-' and '_' (and not '%s')", name, DefaultProfile)
+	}
+	return nil
+}
+
+// ProfileNames returns the profiles of the config, sorted.
+func (s Settings) ProfileNames() []string {
+	names := make([]string, 0, len(s.Profiles))
+	for name := range s.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ForProfile returns the settings of a profile: s with the profile's overrides on top. Overrides only replace
+// the keys they contain, nested ones included, so e.g. {"anilist": {"token": "..."}} keeps the shared client id.
+// The default profile returns s as it is.
+func (s Settings) ForProfile(name string) (Settings, error) {
+	if name == "" || name == DefaultProfile {
+		return s, nil
+	}
+	override, exists := s.Profiles[name]
+	if !exists {
+		return s, fmt.Errorf("Unknown profile '%s', add it with 'profile add %s'", name, name)
+	}
+
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(override, &doc); err != nil {
+		return s, fmt.Errorf("Failed to read the settings of profile '%s': %w", name, err)
+	}
+
+	// An override can't redefine the profiles themselves, decodeObject skips them.
+	layered := s
+	layered.problems = nil
+	layered.decodeObject(doc, "")
+	for i, err := range layered.problems {
+		layered.problems[i] = fmt.Errorf("profile %s: %w", name, err)
+	}
+	layered.problems = append(slices.Clone(s.problems), layered.problems...)
+	layered.markSources(override, SourceProfile+" "+name)
+	return layered, nil
+}
+
+// SetProfileValue stores value as the override of key for a profile, creating the profile if needed.
+func (s *Settings) SetProfileValue(name, key string, value any) error {
+	fields := make(map[string]json.RawMessage)
+	if raw := s.Profiles[name]; len(raw) > 0 {
+		if err := json.Unmarshal(raw, &fields); err != nil {
+			return fmt.Errorf("Failed to read the settings of profile '%s': %w", name, err)
+		}
+	}
+
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	fields[key] = encoded
+
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	if s.Profiles == nil {
+		s.Profiles = make(map[string]json.RawMessage)
+	}
+	s.Profiles[name] = raw
+	return nil
+}
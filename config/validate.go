@@ -0,0 +1,225 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Choices lists the values accepted by the settings that take one of a few, "" being the default.
+// resume matches player.ResumeModes.
+var Choices = map[string][]string{
+	"selector": {"", "auto", "fzf", "sk", "builtin"},
+	"storage":  {"", "bolt", "json"},
+	"resume":   {"", "ask", "resume", "start", "intro"},
+}
+
+// AudioTypes are the types of server hianime has, the values audio_types takes.
+var AudioTypes = []string{"sub", "dub", "raw"}
+
+// decodeStrict reads the config file into s field by field, so a value of the wrong type or an unknown key
+// is reported instead of silently leaving the setting at its zero value. Fields that fail keep their default.
+func (s *Settings) decodeStrict(data []byte) error {
+	var header struct {
+		SchemaVersion int                        `json:"schema_version"`
+		Profiles      map[string]json.RawMessage `json:"profiles"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return err
+	}
+	s.SchemaVersion = header.SchemaVersion
+	s.Profiles = header.Profiles
+
+	var doc map[string]json.RawMessage
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+	s.problems = nil
+	s.decodeObject(doc, "")
+	return nil
+}
+
+func (s *Settings) decodeObject(doc map[string]json.RawMessage, prefix string) {
+	names := make([]string, 0, len(doc))
+	for name := range doc {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+
+	for _, name := range names {
+		key := prefix + name
+		if key == "schema_version" || key == "profiles" {
+			continue
+		}
+
+		if isSection(key) {
+			var nested map[string]json.RawMessage
+			if err := json.Unmarshal(doc[name], &nested); err != nil {
+				s.problems = append(s.problems, fmt.Errorf("%s: expected an object", key))
+				continue
+			}
+			s.decodeObject(nested, key+".")
+			continue
+		}
+
+		field, ok := s.field(key)
+		if !ok {
+			s.problems = append(s.problems, fmt.Errorf("%s: unknown setting, ignored", key))
+			continue
+		}
+		value := reflect.New(field.Type())
+		if err := json.Unmarshal(doc[name], value.Interface()); err != nil {
+			s.problems = append(s.problems, fmt.Errorf("%s: expected %s, using the default", key, typeName(field.Kind())))
+			continue
+		}
+		field.Set(value.Elem())
+	}
+}
+
+// isSection reports whether key holds nested settings, like "watch".
+func isSection(key string) bool {
+	prefix := key + "."
+	for _, k := range Keys() {
+		if strings.HasPrefix(k, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func typeName(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Int:
+		return "a whole number"
+	case reflect.Float64:
+		return "a number"
+	case reflect.Slice:
+		return "a list of strings"
+	}
+	return "a string"
+}
+
+// Problems returns what is wrong with the settings: keys of the file that couldn't be read and invalid values.
+func (s Settings) Problems() []error {
+	problems := slices.Clone(s.problems)
+	for _, key := range Keys() {
+		if err := s.ValidateKey(key); err != nil {
+			problems = append(problems, err)
+		}
+	}
+	return problems
+}
+
+// ValidateKey checks the value of one setting.
+func (s Settings) ValidateKey(key string) error {
+	value, ok := s.Get(key)
+	if !ok {
+		return fmt.Errorf("Unknown setting '%s'", key)
+	}
+
+	if choices, ok := Choices[key]; ok {
+		if !slices.Contains(choices, value) {
+			return fmt.Errorf("%s: '%s' isn't one of %s", key, value, strings.Join(choices[1:], ", "))
+		}
+		return nil
+	}
+
+	switch key {
+	case "audio_types":
+		for _, audio := range s.AudioTypes {
+			if !slices.Contains(AudioTypes, audio) {
+				return fmt.Errorf("%s: '%s' isn't one of %s", key, audio, strings.Join(AudioTypes, ", "))
+			}
+		}
+	case "watched_threshold":
+		if s.WatchedThreshold <= 0 || s.WatchedThreshold > 1 {
+			return fmt.Errorf("%s: %v isn't between 0 and 1", key, s.WatchedThreshold)
+		}
+	case "timeout", "watch.interval", "watch.jitter":
+		if value == "" {
+			return nil
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 || (d == 0 && key != "watch.jitter") {
+			return fmt.Errorf("%s: '%s' isn't a duration like 30s or 10m", key, value)
+		}
+	case "base_url", "jimaku_url", "decrypt_key_url", "watch.webhook_url":
+		if value == "" {
+			return nil
+		}
+		u, err := url.Parse(value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("%s: '%s' isn't an http(s) url", key, value)
+		}
+	case "mpv_path":
+		if value == "" {
+			return nil
+		}
+		if _, err := exec.LookPath(value); err != nil {
+			return fmt.Errorf("%s: '%s' isn't an executable", key, value)
+		}
+	case "data_dir", "cache_dir", "sync.folder":
+		if value == "" {
+			return nil
+		}
+		// Missing directories are created when needed.
+		if info, err := os.Stat(value); err == nil && !info.IsDir() {
+			return fmt.Errorf("%s: '%s' isn't a directory", key, value)
+		}
+	}
+	return nil
+}
+
+// addDefaults is the migration to schema 3: settings missing from the file are written with their default,
+// so the file shows every setting there is.
+func addDefaults(data []byte) ([]byte, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	defaults, err := json.Marshal(defaultConfig())
+	if err != nil {
+		return nil, err
+	}
+	var base map[string]any
+	if err := json.Unmarshal(defaults, &base); err != nil {
+		return nil, err
+	}
+
+	fillMissing(doc, base)
+	doc["schema_version"] = 3
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", " ")
+	if err := enc.Encode(doc); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func fillMissing(doc, defaults map[string]any) {
+	for name, value := range defaults {
+		current, exists := doc[name]
+		if !exists {
+			doc[name] = value
+			continue
+		}
+		nested, isObject := current.(map[string]any)
+		nestedDefaults, defaultIsObject := value.(map[string]any)
+		if isObject && defaultIsObject {
+			fillMissing(nested, nestedDefaults)
+		}
+	}
+}
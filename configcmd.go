@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"hianime-mpv-go/config"
+	"hianime-mpv-go/state"
+	"hianime-mpv-go/ui"
+)
+
+const configUsage = `Usage:
+  config [show]   Print every setting, its value and where it comes from
+  config edit     Change the settings of the config file from a menu
+
+Settings are read from, by precedence: -set key=value flags, HIANIME_* environment variables
+(see the ENV column), the profile's overrides, the config file and the defaults.`
+
+func cmdConfig(args []string, history []state.History, configSession config.Settings) error {
+	action := "show"
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		action, args = args[0], args[1:]
+	}
+
+	switch action {
+	case "show":
+		positional, err := parseInterleaved(newFlagSet("config show"), args)
+		if err != nil || len(positional) != 0 {
+			return errUsage
+		}
+
+		entries := configSession.Effective()
+		if ui.Output != ui.OutputText {
+			return ui.PrintRecords("setting", entries)
+		}
+		fmt.Printf("--> Config file: %s\n\n", config.FileName)
+		ui.PrintSettings(entries)
+		return nil
+	case "edit":
+		positional, err := parseInterleaved(newFlagSet("config edit"), args)
+		if err != nil || len(positional) != 0 {
+			return errUsage
+		}
+		return editConfig(configSession)
+	case "help":
+		fmt.Println(configUsage)
+		return nil
+	}
+
+	fmt.Fprintln(os.Stderr, configUsage)
+	return errUsage
+}
+
+// editConfig lets the settings of the config file be changed one by one, then saves them with SaveConfig.
+// Booleans are toggled, the others are typed in. Invalid values are refused.
+func editConfig(configSession config.Settings) error {
+	// The file alone, so the environment, flags and profile overrides don't end up saved in it.
+	saved, err := config.LoadConfig()
+	if err != nil {
+		return err
+	}
+	keys := config.Keys()
+	changed := false
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Printf("\n--- Settings (%s) ---\n", config.FileName)
+		for i, key := range keys {
+			value, _ := saved.Get(key)
+			if config.IsSecret(key) && value != "" {
+				value = "********"
+			}
+			note := ""
+			if source := configSession.Source(key); source != config.SourceFile && source != config.SourceDefault {
+				note = "  (overridden by " + source + ")"
+			}
+			fmt.Printf(" [%d] %s = %s%s\n", i+1, key, strconv.Quote(value), note)
+		}
+
+		fmt.Print("\nNumber of the setting to change, s to save, q to quit: ")
+		if !scanner.Scan() {
+			return nil
+		}
+		input := strings.TrimSpace(scanner.Text())
+
+		switch input {
+		case "s":
+			if !changed {
+				fmt.Println("--> Nothing changed.")
+				return nil
+			}
+			if err := config.SaveConfig(saved); err != nil {
+				return err
+			}
+			fmt.Println("--> Saved the settings.")
+			return nil
+		case "q":
+			if changed {
+				fmt.Println("--! Quit without saving.")
+			}
+			return nil
+		}
+
+		num, err := strconv.Atoi(input)
+		if err != nil || num < 1 || num > len(keys) {
+			fmt.Println("Number is invalid.")
+			continue
+		}
+		key := keys[num-1]
+
+		value, ok := editValue(scanner, saved, key)
+		if !ok {
+			continue
+		}
+		edited := saved
+		if err := edited.Set(key, value, config.SourceFile); err != nil {
+			fmt.Println("--! " + err.Error())
+			continue
+		}
+		if err := edited.ValidateKey(key); err != nil {
+			fmt.Println("--! " + err.Error())
+			continue
+		}
+		saved = edited
+		changed = true
+	}
+}
+
+// editValue returns the new value of a setting: booleans are toggled, settings with choices are picked from them
+// and the others are typed. It reports false when the setting is left as it is.
+func editValue(scanner *bufio.Scanner, saved config.Settings, key string) (string, bool) {
+	if config.IsBool(key) {
+		current, _ := saved.Get(key)
+		b, _ := strconv.ParseBool(current)
+		return strconv.FormatBool(!b), true
+	}
+
+	if choices, ok := config.Choices[key]; ok {
+		fmt.Printf("%s: %s (enter to keep, - for the default): ", key, strings.Join(choices[1:], ", "))
+	} else {
+		fmt.Printf("New %s (enter to keep, - to clear): ", key)
+	}
+	if !scanner.Scan() {
+		return "", false
+	}
+
+	value := strings.TrimSpace(scanner.Text())
+	switch value {
+	case "":
+		return "", false
+	case "-":
+		return "", true
+	}
+	return value, true
+}
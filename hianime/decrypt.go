@@ -0,0 +1,163 @@
+package hianime
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// DecryptKey is the passphrase of the encrypted sources. When empty it is fetched from DecryptKeyURL.
+var DecryptKey string
+
+// DecryptKeyURL serves the passphrase as plain text, kept up to date as the embed hosts rotate it. Nothing is
+// fetched while it is empty.
+var DecryptKeyURL string
+
+var (
+	keyMutex   sync.Mutex
+	fetchedKey string // passphrase fetched from DecryptKeyURL, for the rest of the session
+)
+
+// KeyConfigured reports whether encrypted sources can be decrypted. Without a key the servers sending them are
+// left out.
+func KeyConfigured() bool {
+	return DecryptKey != "" || DecryptKeyURL != ""
+}
+
+// SourceFiles is the "sources" field of getSources: the list of files, or that list encrypted into a base64 string.
+type SourceFiles struct {
+	Files     []Source
+	Encrypted string
+}
+
+func (s *SourceFiles) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		return json.Unmarshal(data, &s.Encrypted)
+	}
+	return json.Unmarshal(data, &s.Files)
+}
+
+// decryptSources turns encrypted sources into files. A fetched passphrase that no longer works is fetched
+// again once, in case it was rotated since.
+func decryptSources(encrypted string) ([]Source, error) {
+	if DecryptKey != "" {
+		return DecryptSources(encrypted, DecryptKey)
+	}
+
+	key, err := decryptionKey(false)
+	if err != nil {
+		return nil, err
+	}
+	files, err := DecryptSources(encrypted, key)
+	if err == nil {
+		return files, nil
+	}
+
+	fmt.Println("--> Decryption key didn't work, fetching it again...")
+	fresh, keyErr := decryptionKey(true)
+	if keyErr != nil || fresh == key {
+		return nil, err
+	}
+	return DecryptSources(encrypted, fresh)
+}
+
+// decryptionKey returns the passphrase fetched from DecryptKeyURL, fetching it when not known yet or when refresh is set.
+func decryptionKey(refresh bool) (string, error) {
+	keyMutex.Lock()
+	defer keyMutex.Unlock()
+
+	if fetchedKey != "" && !refresh {
+		return fetchedKey, nil
+	}
+	if DecryptKeyURL == "" {
+		return "", fmt.Errorf("Sources are encrypted and no decryption key is configured, set decrypt_key or decrypt_key_url")
+	}
+
+	resp, err := Client.Get(DecryptKeyURL)
+	if err != nil {
+		return "", fmt.Errorf("Failed to fetch the decryption key: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Decryption key url returned %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if err != nil {
+		return "", fmt.Errorf("Failed to read the decryption key: %w", err)
+	}
+	key := strings.TrimSpace(string(body))
+	if key == "" {
+		return "", fmt.Errorf("Decryption key url returned an empty key")
+	}
+
+	fetchedKey = key
+	return key, nil
+}
+
+// DecryptSources decrypts the sources of an encrypted getSources response. They are AES-256-CBC encrypted the
+// way `openssl enc` does: base64 of "Salted__", an 8 byte salt and the ciphertext, with the key and iv derived
+// from the passphrase and the salt.
+func DecryptSources(encrypted, passphrase string) ([]Source, error) {
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encrypted))
+	if err != nil {
+		return nil, fmt.Errorf("Failed to decode the encrypted sources: %w", err)
+	}
+	if len(data) < 16 || string(data[:8]) != "Salted__" {
+		return nil, fmt.Errorf("Encrypted sources have no salt")
+	}
+	salt, ciphertext := data[8:16], data[16:]
+	if len(ciphertext) == 0 || len(ciphertext)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("Encrypted sources have a bad length")
+	}
+
+	key, iv := deriveKey([]byte(passphrase), salt, 32, aes.BlockSize)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	plain := make([]byte, len(ciphertext))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(plain, ciphertext)
+
+	plain, err = unpad(plain)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []Source
+	if err := json.Unmarshal(plain, &files); err != nil {
+		return nil, fmt.Errorf("Failed to decrypt the sources, the key may be outdated: %w", err)
+	}
+	return files, nil
+}
+
+// deriveKey is OpenSSL's EVP_BytesToKey with MD5 and one round.
+func deriveKey(passphrase, salt []byte, keyLen, ivLen int) ([]byte, []byte) {
+	var derived, block []byte
+	for len(derived) < keyLen+ivLen {
+		h := md5.New()
+		h.Write(block)
+		h.Write(passphrase)
+		h.Write(salt)
+		block = h.Sum(nil)
+		derived = append(derived, block...)
+	}
+	return derived[:keyLen], derived[keyLen : keyLen+ivLen]
+}
+
+// unpad removes the PKCS#7 padding. Bad padding almost always means a wrong key.
+func unpad(data []byte) ([]byte, error) {
+	n := int(data[len(data)-1])
+	if n == 0 || n > aes.BlockSize || n > len(data) || !bytes.Equal(data[len(data)-n:], bytes.Repeat([]byte{byte(n)}, n)) {
+		return nil, fmt.Errorf("Failed to decrypt the sources, the key may be outdated")
+	}
+	return data[:len(data)-n], nil
+}
@@ -0,0 +1,283 @@
+package hianime
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// testdata/getsources_encrypted.json is synthetic: a response shaped like the getSources of an HD-3 embed, with
+// made up urls, its sources encrypted with `openssl enc -aes-256-cbc -md md5 -salt -a -A` and this passphrase.
+// It checks the decryption against OpenSSL's, not against a key the embed hosts currently use.
+const fixturePassphrase = "hd3-test-passphrase"
+
+var fixtureFiles = []Source{{File: "https://cdn.example/_v7/5f1b2c/master.m3u8", Type: "hls"}}
+
+func readFixture(t *testing.T) []byte {
+	t.Helper()
+	body, err := os.ReadFile("testdata/getsources_encrypted.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return body
+}
+
+func fixtureSources(t *testing.T) Sources {
+	t.Helper()
+	var sources Sources
+	if err := json.Unmarshal(readFixture(t), &sources); err != nil {
+		t.Fatal(err)
+	}
+	return sources
+}
+
+// encrypt encrypts like the embed hosts do, with a fixed salt, leaving out the padding when pad is false.
+func encrypt(t *testing.T, plain, passphrase string, pad bool) string {
+	t.Helper()
+	salt := []byte("12345678")
+	data := []byte(plain)
+	if pad {
+		n := aes.BlockSize - len(data)%aes.BlockSize
+		data = append(data, bytes.Repeat([]byte{byte(n)}, n)...)
+	} else if len(data)%aes.BlockSize != 0 {
+		t.Fatalf("%d bytes don't fill whole blocks", len(data))
+	}
+
+	key, iv := deriveKey([]byte(passphrase), salt, 32, aes.BlockSize)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ciphertext := make([]byte, len(data))
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(ciphertext, data)
+	return base64.StdEncoding.EncodeToString(append(append([]byte("Salted__"), salt...), ciphertext...))
+}
+
+// resetKeys clears the key settings and the fetched key once the test is done.
+func resetKeys(t *testing.T) {
+	t.Helper()
+	t.Cleanup(func() {
+		DecryptKey, DecryptKeyURL, fetchedKey = "", "", ""
+	})
+}
+
+func TestDecryptSources(t *testing.T) {
+	sources := fixtureSources(t)
+	if sources.Sources.Encrypted == "" || len(sources.Sources.Files) != 0 {
+		t.Fatalf("sources %+v, want the encrypted string", sources.Sources)
+	}
+
+	files, err := DecryptSources(sources.Sources.Encrypted, fixturePassphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != len(fixtureFiles) || files[0] != fixtureFiles[0] {
+		t.Errorf("got %+v, want %+v", files, fixtureFiles)
+	}
+}
+
+func TestDecryptSourcesErrors(t *testing.T) {
+	encrypted := fixtureSources(t).Sources.Encrypted
+	salted := base64.StdEncoding.EncodeToString([]byte("Salted__12345678"))
+
+	tests := []struct {
+		name      string
+		encrypted string
+		key       string
+		want      string
+	}{
+		{"wrong key", encrypted, "rotated-passphrase", "the key may be outdated"},
+		{"bad padding", encrypt(t, strings.Repeat("x", 32), fixturePassphrase, false), fixturePassphrase, "the key may be outdated"},
+		{"not the sources", encrypt(t, "<html></html>", fixturePassphrase, true), fixturePassphrase, "the key may be outdated"},
+		{"not base64", "not base64!", fixturePassphrase, "Failed to decode"},
+		{"no salt", base64.StdEncoding.EncodeToString([]byte(strings.Repeat("x", 32))), fixturePassphrase, "no salt"},
+		{"no ciphertext", salted, fixturePassphrase, "bad length"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := DecryptSources(tt.encrypted, tt.key)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %+v, %v; want an error containing %q", files, err, tt.want)
+			}
+		})
+	}
+}
+
+// keyServer serves the queued keys in turn, repeating the last one.
+type keyServer struct {
+	mu      sync.Mutex
+	keys    []string
+	fetches int
+}
+
+func (k *keyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	key := k.keys[min(k.fetches, len(k.keys)-1)]
+	k.fetches++
+	w.Write([]byte(key + "\n"))
+}
+
+func (k *keyServer) count() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.fetches
+}
+
+func TestDecryptSourcesFetchesRotatedKey(t *testing.T) {
+	resetKeys(t)
+	keys := &keyServer{keys: []string{"rotated-passphrase", fixturePassphrase}}
+	srv := httptest.NewServer(keys)
+	defer srv.Close()
+	DecryptKeyURL = srv.URL
+
+	encrypted := fixtureSources(t).Sources.Encrypted
+	files, err := decryptSources(encrypted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files[0] != fixtureFiles[0] {
+		t.Errorf("got %+v, want %+v", files, fixtureFiles)
+	}
+	if n := keys.count(); n != 2 {
+		t.Errorf("key fetched %d times, want 2", n)
+	}
+
+	// The working key is kept for the session.
+	if _, err := decryptSources(encrypted); err != nil {
+		t.Fatal(err)
+	}
+	if n := keys.count(); n != 2 {
+		t.Errorf("key fetched %d times, want still 2", n)
+	}
+}
+
+func TestDecryptSourcesKeepsErrorOfSameKey(t *testing.T) {
+	resetKeys(t)
+	keys := &keyServer{keys: []string{"rotated-passphrase"}}
+	srv := httptest.NewServer(keys)
+	defer srv.Close()
+	DecryptKeyURL = srv.URL
+
+	if _, err := decryptSources(fixtureSources(t).Sources.Encrypted); err == nil || !strings.Contains(err.Error(), "the key may be outdated") {
+		t.Errorf("got %v, want the decryption error", err)
+	}
+	if n := keys.count(); n != 2 {
+		t.Errorf("key fetched %d times, want 2", n)
+	}
+}
+
+func TestDecryptSourcesWithoutKey(t *testing.T) {
+	resetKeys(t)
+	if _, err := decryptSources(fixtureSources(t).Sources.Encrypted); err == nil || !strings.Contains(err.Error(), "no decryption key is configured") {
+		t.Errorf("got %v, want an error asking for a key", err)
+	}
+
+	// A configured key is used as is, nothing is fetched.
+	DecryptKey = fixturePassphrase
+	DecryptKeyURL = "http://127.0.0.1:0/unreachable"
+	if files, err := decryptSources(fixtureSources(t).Sources.Encrypted); err != nil || len(files) != 1 {
+		t.Errorf("got %+v, %v; want the files", files, err)
+	}
+}
+
+func TestSourceFilesUnmarshal(t *testing.T) {
+	var plain Sources
+	body := `{"sources":[{"file":"https://cdn.example/master.m3u8","type":"hls"}],"encrypted":false}`
+	if err := json.Unmarshal([]byte(body), &plain); err != nil {
+		t.Fatal(err)
+	}
+	if plain.Sources.Encrypted != "" || len(plain.Sources.Files) != 1 || plain.Sources.Files[0].File != "https://cdn.example/master.m3u8" {
+		t.Errorf("got %+v, want one file", plain.Sources)
+	}
+
+	var encrypted Sources
+	if err := json.Unmarshal([]byte(`{"sources":"U2FsdGVkX18=","encrypted":true}`), &encrypted); err != nil {
+		t.Fatal(err)
+	}
+	if encrypted.Sources.Encrypted != "U2FsdGVkX18=" || len(encrypted.Sources.Files) != 0 {
+		t.Errorf("got %+v, want the encrypted string", encrypted.Sources)
+	}
+
+	var bad Sources
+	if err := json.Unmarshal([]byte(`{"sources":{"file":"x"}}`), &bad); err == nil {
+		t.Error("an object as sources was accepted")
+	}
+}
+
+func TestExtractDouvid(t *testing.T) {
+	resetKeys(t)
+	DecryptKey = fixturePassphrase
+	body := readFixture(t)
+
+	var sourcesQuery string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/embed-2/v3/e-1/getSources", func(w http.ResponseWriter, r *http.Request) {
+		sourcesQuery = r.URL.RawQuery
+		w.Write(body)
+	})
+	mux.HandleFunc("/embed-2/v3/e-1/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<html><body><div id="player"></div></body></html>`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	stream, err := ExtractDouvid(srv.URL + "/embed-2/v3/e-1/Xk3pQ9?k=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sourcesQuery != "id=Xk3pQ9" {
+		t.Errorf("getSources query %q, want the id from the url and no nonce", sourcesQuery)
+	}
+	if stream.Url != fixtureFiles[0].File || stream.Referer != srv.URL+"/" {
+		t.Errorf("got %s from %s, want %s", stream.Url, stream.Referer, fixtureFiles[0].File)
+	}
+	if len(stream.Tracks) != 2 || stream.Tracks[0].Label != "English" || stream.Intro.End != 120 || stream.Outro.Start != 1325 {
+		t.Errorf("got tracks %+v intro %+v outro %+v, want the ones of the response", stream.Tracks, stream.Intro, stream.Outro)
+	}
+}
+
+func TestExtractorFor(t *testing.T) {
+	tests := map[string]string{
+		"https://douvid.xyz/embed-2/v3/e-1/Xk3pQ9?k=1":     "douvid",
+		"https://megacloud.blog/embed-2/v3/e-1/Xk3pQ9?k=1": "megacloud",
+		"https://unknown.example/e/Xk3pQ9":                 "megacloud",
+		"not a url":                                        "megacloud",
+	}
+	for embedUrl, want := range tests {
+		if got := ExtractorFor(embedUrl).Name; got != want {
+			t.Errorf("ExtractorFor(%q) = %s, want %s", embedUrl, got, want)
+		}
+	}
+}
+
+func TestServersLeaveOutHD3WithoutKey(t *testing.T) {
+	resetKeys(t)
+	servers := `<div class="server-item" data-type="sub" data-id="1"><a>HD-1</a></div>` +
+		`<div class="server-item" data-type="sub" data-id="3"><a>HD-3</a></div>`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(AjaxResponse{Status: true, Html: servers})
+	}))
+	defer srv.Close()
+
+	baseUrl := BaseUrl
+	BaseUrl = srv.URL
+	t.Cleanup(func() { BaseUrl = baseUrl })
+
+	if list := GetEpisodeServerId(1); len(list) != 1 || list[0].Name != "HD-1" {
+		t.Errorf("got %+v, want HD-3 left out", list)
+	}
+
+	DecryptKey = fixturePassphrase
+	if list := GetEpisodeServerId(1); len(list) != 2 {
+		t.Errorf("got %+v, want HD-3 listed once a key is set", list)
+	}
+}
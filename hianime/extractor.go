@@ -7,28 +7,46 @@ import (
 	"log"
 	"net/http"
 	"net/url"
+	"path"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/PuerkitoBio/goquery"
+
+	"hianime-mpv-go/config"
 )
 
 var BaseUrl string = "https://hianime.to"
 
+// DefaultTimeout bounds every request unless the config says otherwise.
+const DefaultTimeout = 30 * time.Second
+
+// Client makes every request to hianime and the embed hosts.
+var Client = &http.Client{Timeout: DefaultTimeout}
+
 // This is where the hianime scrapper logic lives. Check types.go in this same directory to see all the struct types.
 
 func GetSeriesData(series_url string) SeriesData {
-	resp, err := http.Get(series_url)
+	data, err := FetchSeriesData(series_url)
 	if err != nil {
 		log.Fatal(err)
 	}
+	return data
+}
+
+// FetchSeriesData is GetSeriesData returning the error instead of exiting, for callers going through many series.
+func FetchSeriesData(series_url string) (SeriesData, error) {
+	resp, err := Client.Get(series_url)
+	if err != nil {
+		return SeriesData{}, err
+	}
 	defer resp.Body.Close()
 
 	doc, err := goquery.NewDocumentFromReader(resp.Body)
 	if err != nil {
-		log.Fatal(err)
+		return SeriesData{}, err
 	}
 
 	// series_html, err := doc.Html()
@@ -50,26 +68,39 @@ func GetSeriesData(series_url string) SeriesData {
 	data.EnglishName = strings.TrimSpace(header.Text())
 	data.JapaneseName = strings.TrimSpace(jname)
 
-	return data
+	return data, nil
 }
 
 func GetEpisodes(animeId string) []Episodes {
+	episodes, err := FetchEpisodes(animeId)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return episodes
+}
+
+// FetchEpisodes is GetEpisodes returning the error instead of exiting, for callers checking many series at once.
+func FetchEpisodes(animeId string) ([]Episodes, error) {
 	apiUrl := fmt.Sprintf("%s/ajax/v2/episode/list/%s", BaseUrl, animeId)
 
-	apiResp, err := http.Get(apiUrl)
+	apiResp, err := Client.Get(apiUrl)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	defer apiResp.Body.Close()
+	if apiResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Episode list of %s returned %s", animeId, apiResp.Status)
+	}
+
 	var jsonResp AjaxResponse
 	if err := json.NewDecoder(apiResp.Body).Decode(&jsonResp); err != nil {
-		panic("Failed to decode JSON: " + err.Error())
+		return nil, fmt.Errorf("Failed to decode JSON: %w", err)
 	}
 
 	apiDoc, err := goquery.NewDocumentFromReader(strings.NewReader(jsonResp.Html))
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
 
 	var episodes []Episodes
@@ -113,13 +144,13 @@ func GetEpisodes(animeId string) []Episodes {
 	//
 	// os.WriteFile("onepiece.html", []byte(api_html), 0644)
 
-	return episodes
+	return episodes, nil
 }
 
 func GetEpisodeServerId(episodeId int) []ServerList {
 	serverUrl := fmt.Sprintf("%s/ajax/v2/episode/servers?episodeId=%d", BaseUrl, episodeId)
 
-	serverResp, err := http.Get(serverUrl)
+	serverResp, err := Client.Get(serverUrl)
 	if err != nil {
 		fmt.Println("Error while requesting server urls: " + err.Error())
 	}
@@ -156,8 +187,8 @@ func GetEpisodeServerId(episodeId int) []ServerList {
 
 		name := s.Find("a").Text()
 
-		// NOTE: Excluding the HD-3 servers for now
-		if strings.Contains("HD-3", name) {
+		// HD-3 sends encrypted sources, unplayable without a decryption key.
+		if strings.Contains(name, "HD-3") && !KeyConfigured() {
 			return
 		}
 
@@ -176,7 +207,7 @@ func GetEpisodeServerId(episodeId int) []ServerList {
 func GetStreamData(serverId int) (StreamData, error) {
 	serverUrl := fmt.Sprintf("%s/ajax/v2/episode/sources?id=%d", BaseUrl, serverId)
 
-	resp, err := http.Get(serverUrl)
+	resp, err := Client.Get(serverUrl)
 	if err != nil {
 		fmt.Println("Failed to connect with server url: " + err.Error())
 	}
@@ -192,7 +223,11 @@ func GetStreamData(serverId int) (StreamData, error) {
 		url = respJson.Url
 	}
 
-	return ExtractMegacloud(url)
+	extractor := ExtractorFor(url)
+	if config.DebugMode {
+		fmt.Printf("--> Extracting with '%s'...\n", extractor.Name)
+	}
+	return extractor.Extract(url)
 }
 
 func GetNonce(html string) string {
@@ -212,7 +247,20 @@ func GetNonce(html string) string {
 	return ""
 }
 
+// ExtractMegacloud extracts the stream of a megacloud embed.
 func ExtractMegacloud(iframeUrl string) (StreamData, error) {
+	return extractEmbed(iframeUrl, true)
+}
+
+// ExtractDouvid extracts the stream of a douvid embed, the one HD-3 uses. Its player is megacloud's, but its pages
+// may come without a nonce and its sources are encrypted.
+func ExtractDouvid(iframeUrl string) (StreamData, error) {
+	return extractEmbed(iframeUrl, false)
+}
+
+// extractEmbed reads the file id and nonce from the embed page and fetches the sources. Without requireNonce
+// the page is read once and a missing nonce is left out of the request.
+func extractEmbed(iframeUrl string, requireNonce bool) (StreamData, error) {
 	parsedUrl, err := url.Parse(iframeUrl)
 	if err != nil {
 		return StreamData{}, fmt.Errorf("Failed to parse url: %w", err)
@@ -228,9 +276,12 @@ func ExtractMegacloud(iframeUrl string) (StreamData, error) {
 	req.Header.Set("User-Agent", userAgent)
 	req.Header.Set("Referer", defaultDomain)
 
-	client := &http.Client{}
+	client := Client
 
 	maxAttempt := 3
+	if !requireNonce {
+		maxAttempt = 1
+	}
 	var fileId string
 	var nonce string
 
@@ -252,6 +303,10 @@ func ExtractMegacloud(iframeUrl string) (StreamData, error) {
 		}
 		megacloudPlayer := docMegacloud.Find("#megacloud-player")
 		id, exists := megacloudPlayer.Attr("data-id")
+		if !exists && !requireNonce {
+			// The embed url ends with the file id, like /embed-2/v3/e-1/<id>?k=1.
+			id, exists = path.Base(parsedUrl.Path), parsedUrl.Path != ""
+		}
 		if !exists {
 			fmt.Println("Couldn't found 'fileId'.")
 			continue
@@ -263,7 +318,10 @@ func ExtractMegacloud(iframeUrl string) (StreamData, error) {
 		outerHtml, _ := goquery.OuterHtml(singleSelect)
 
 		nonce = GetNonce(outerHtml)
-		if nonce == "" {
+		if nonce == "" && !requireNonce {
+			fmt.Println("\n--> Extract success.")
+			break
+		} else if nonce == "" {
 			fmt.Println("Could not find nonce.")
 			time.Sleep(1 * time.Second)
 			continue
@@ -273,7 +331,10 @@ func ExtractMegacloud(iframeUrl string) (StreamData, error) {
 		}
 	}
 
-	sourcesUrl := fmt.Sprintf("%sembed-2/v3/e-1/getSources?id=%s&_k=%s", defaultDomain, fileId, nonce)
+	sourcesUrl := fmt.Sprintf("%sembed-2/v3/e-1/getSources?id=%s", defaultDomain, fileId)
+	if nonce != "" || requireNonce {
+		sourcesUrl += "&_k=" + nonce
+	}
 	sourceReq, err := http.NewRequest("GET", sourcesUrl, nil)
 	if err != nil {
 		return StreamData{}, fmt.Errorf("Failed when requesting source url: %w", err)
@@ -304,21 +365,26 @@ func ExtractMegacloud(iframeUrl string) (StreamData, error) {
 		return StreamData{}, fmt.Errorf("Failed to convert to JSON: %w", err)
 	}
 
-	streamMap := StreamData{}
-
-	//  NOTE: Still can't play server 'HD-3' (url=douvid.xyz), because it was returning EXT encrypted, and impossible for mpv to play.
-	if !sourceJson.Encrypted || strings.Contains(sourceJson.Sources[0].File, ".m3u8") {
-		streamMap = StreamData{
-			Url:       sourceJson.Sources[0].File,
-			UserAgent: userAgent,
-			Referer:   defaultDomain,
-			Origin:    defaultDomain,
-			Tracks:    sourceJson.Tracks,
-			Intro:     sourceJson.Intro,
-			Outro:     sourceJson.Outro,
+	files := sourceJson.Sources.Files
+	if sourceJson.Sources.Encrypted != "" {
+		fmt.Println("--> Sources are encrypted. Decrypting...")
+		files, err = decryptSources(sourceJson.Sources.Encrypted)
+		if err != nil {
+			return StreamData{}, err
 		}
-	} else {
-		return StreamData{}, fmt.Errorf("Files are encrypted. Try other servers.")
+	}
+	if len(files) == 0 || files[0].File == "" {
+		return StreamData{}, fmt.Errorf("No sources found. Try other servers.")
+	}
+
+	streamMap := StreamData{
+		Url:       files[0].File,
+		UserAgent: userAgent,
+		Referer:   defaultDomain,
+		Origin:    defaultDomain,
+		Tracks:    sourceJson.Tracks,
+		Intro:     sourceJson.Intro,
+		Outro:     sourceJson.Outro,
 	}
 
 	return streamMap, nil
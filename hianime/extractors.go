@@ -0,0 +1,42 @@
+package hianime
+
+import (
+	"net/url"
+	"strings"
+)
+
+// Extractor turns the embed url of a server into its stream.
+type Extractor struct {
+	Name    string
+	Hosts   []string // parts of the embed host it handles, like "megacloud"
+	Extract func(embedUrl string) (StreamData, error)
+}
+
+// extractors are tried in order, the first whose host matches wins. The last one, megacloud, also takes the
+// embeds no extractor claims.
+var extractors = []Extractor{
+	{Name: "douvid", Hosts: []string{"douvid"}, Extract: ExtractDouvid},
+	{Name: "megacloud", Hosts: []string{"megacloud"}, Extract: ExtractMegacloud},
+}
+
+// RegisterExtractor adds an extractor, taking precedence over the ones already registered.
+func RegisterExtractor(extractor Extractor) {
+	extractors = append([]Extractor{extractor}, extractors...)
+}
+
+// ExtractorFor returns the extractor of an embed url.
+func ExtractorFor(embedUrl string) Extractor {
+	host := ""
+	if parsed, err := url.Parse(embedUrl); err == nil {
+		host = strings.ToLower(parsed.Hostname())
+	}
+
+	for _, extractor := range extractors {
+		for _, h := range extractor.Hosts {
+			if host != "" && strings.Contains(host, h) {
+				return extractor
+			}
+		}
+	}
+	return extractors[len(extractors)-1]
+}
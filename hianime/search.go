@@ -2,7 +2,8 @@ package hianime
 
 import (
 	"fmt"
-	"net/http"
+	"net/url"
+	"path"
 	"strconv"
 	"strings"
 
@@ -10,9 +11,9 @@ import (
 )
 
 func Search(query string) ([]SearchElements, error) {
-	searchUrl := "https://hianime.to/search?keyword=" + query
+	searchUrl := BaseUrl + "/search?keyword=" + url.QueryEscape(query)
 
-	res, err := http.Get(searchUrl)
+	res, err := Client.Get(searchUrl)
 	if err != nil {
 		return []SearchElements{}, fmt.Errorf("Error while fetching search feature: %w", err)
 	}
@@ -63,3 +64,33 @@ func Search(query string) ([]SearchElements, error) {
 
 	return results, nil
 }
+
+// SeriesData builds the metadata of a search result without fetching the series page. AnilistID and MalID stay empty.
+func (s SearchElements) SeriesData() SeriesData {
+	return SeriesData{
+		AnimeID:      AnimeIDFromUrl(s.Url),
+		EnglishName:  s.EnglishName,
+		JapaneseName: s.JapaneseName,
+		SeriesUrl:    s.Url,
+	}
+}
+
+// AnimeIDFromUrl extracts the anime id from a series or watch url, e.g. "https://hianime.to/watch/one-piece-100?ep=2142" gives "100".
+func AnimeIDFromUrl(seriesUrl string) string {
+	parsed, err := url.Parse(seriesUrl)
+	if err != nil {
+		return ""
+	}
+
+	slug := path.Base(strings.TrimRight(parsed.Path, "/"))
+	idx := strings.LastIndex(slug, "-")
+	if idx == -1 {
+		return ""
+	}
+
+	id := slug[idx+1:]
+	if _, err := strconv.Atoi(id); err != nil {
+		return ""
+	}
+	return id
+}
@@ -4,23 +4,24 @@ type SeriesData struct {
 	AnimeID      string `json:"anime_id"`
 	EnglishName  string `json:"name"`
 	AnilistID    string `json:"anilist_id"`
+	MalID        string `json:"mal_id"`
 	SeriesUrl    string `json:"series_url"`
-	JapaneseName string
+	JapaneseName string `json:"japanese_name"`
 }
 
 type Episodes struct {
-	Number        int
-	EnglishTitle  string
-	JapaneseTitle string
-	Url           string
-	Id            int
+	Number        int    `json:"number"`
+	EnglishTitle  string `json:"english_title"`
+	JapaneseTitle string `json:"japanese_title"`
+	Url           string `json:"url"`
+	Id            int    `json:"id"`
 }
 
 type ServerList struct {
-	Type   string
-	Name   string
-	DataId int
-	Id     int
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	DataId int    `json:"data_id"`
+	Id     int    `json:"id"`
 }
 type AjaxResponse struct {
 	Status bool   `json:"status"`
@@ -33,13 +34,13 @@ type MegacloudUrl struct {
 }
 
 type StreamData struct {
-	Url       string
-	UserAgent string
-	Referer   string
-	Origin    string
-	Tracks    []Track
-	Intro     Timestamp
-	Outro     Timestamp
+	Url       string    `json:"url"`
+	UserAgent string    `json:"user_agent"`
+	Referer   string    `json:"referer"`
+	Origin    string    `json:"origin"`
+	Tracks    []Track   `json:"tracks"`
+	Intro     Timestamp `json:"intro"`
+	Outro     Timestamp `json:"outro"`
 }
 
 type Track struct {
@@ -55,12 +56,12 @@ type Timestamp struct {
 }
 
 type Sources struct {
-	Sources   []Source  `json:"sources"`
-	Tracks    []Track   `json:"tracks"`
-	Encrypted bool      `json:"encrypted"`
-	Intro     Timestamp `json:"intro"`
-	Outro     Timestamp `json:"outro"`
-	Server    int       `json:"server"`
+	Sources   SourceFiles `json:"sources"`
+	Tracks    []Track     `json:"tracks"`
+	Encrypted bool        `json:"encrypted"`
+	Intro     Timestamp   `json:"intro"`
+	Outro     Timestamp   `json:"outro"`
+	Server    int         `json:"server"`
 }
 
 type Source struct {
@@ -69,10 +70,10 @@ type Source struct {
 }
 
 type SearchElements struct {
-	EnglishName    string
-	JapaneseName   string
-	Url            string
-	Type           string
-	Duration       string
-	NumberEpisodes int16
+	EnglishName    string `json:"english_name"`
+	JapaneseName   string `json:"japanese_name"`
+	Url            string `json:"url"`
+	Type           string `json:"type"`
+	Duration       string `json:"duration"`
+	NumberEpisodes int16  `json:"episode_count"`
 }
@@ -4,7 +4,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"net/url"
 	"os"
@@ -14,6 +13,7 @@ import (
 	"strings"
 
 	"hianime-mpv-go/hianime"
+	"hianime-mpv-go/paths"
 )
 
 type Search []SearchElement
@@ -33,8 +33,11 @@ type FileElement struct {
 var UserAgent = ""
 var JimakuBaseUrl string = "https://jimaku.cc"
 
-// Set your JimakuAPI to environment variable or just put it directly in this variable as a string.
-var JimakuApi string = os.Getenv("JIMAKU_API_KEY") // or "xxxxxxxxx"
+// JimakuApi is the API key, set from the config (jimaku_api_key, HIANIME_JIMAKU_API_KEY or JIMAKU_API_KEY).
+var JimakuApi string
+
+// Client makes every request to Jimaku.
+var Client = &http.Client{Timeout: hianime.DefaultTimeout}
 
 func downloadFile(url string, filePath string) (string, error) {
 	cleanPath := strings.TrimRight(filePath, ".")
@@ -48,7 +51,7 @@ func downloadFile(url string, filePath string) (string, error) {
 	}
 	defer out.Close()
 
-	resp, err := http.Get(url)
+	resp, err := Client.Get(url)
 	if err != nil {
 		return "", fmt.Errorf("Couldn't fetch the following url: %w", err)
 	}
@@ -84,7 +87,7 @@ func getFiles(entry_id, episodeNum int) (Files, error) {
 
 	req.Header.Add("Authorization", JimakuApi)
 
-	res, err := http.DefaultClient.Do(req)
+	res, err := Client.Do(req)
 	if err != nil {
 		return Files{}, fmt.Errorf("Failed to request entry id: %w", err)
 	}
@@ -133,7 +136,7 @@ func GetSubsJimaku(seriesData hianime.SeriesData, episodeNum int) ([]string, err
 
 	req.URL.RawQuery = query.Encode()
 
-	res, err := http.DefaultClient.Do(req)
+	res, err := Client.Do(req)
 	if err != nil {
 		return []string{}, fmt.Errorf("Failed to request query: %w", err)
 	}
@@ -162,12 +165,10 @@ func GetSubsJimaku(seriesData hianime.SeriesData, episodeNum int) ([]string, err
 		return []string{}, fmt.Errorf("Failed when getting files: %w", err)
 	}
 
-	homeDir, err := os.UserHomeDir()
+	defaultPath, err := paths.Subtitles()
 	if err != nil {
-		log.Fatalf("Failed to get home directory: %v", err)
+		return []string{}, err
 	}
-
-	defaultPath := filepath.Join(homeDir, "subtitle")
 	re := regexp.MustCompile(`[<>:"/\\|?*\.]`)
 	cleanName := re.ReplaceAllString(data[0].RomajiName, "")
 
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"hianime-mpv-go/config"
+	"hianime-mpv-go/state"
+	"hianime-mpv-go/ui"
+)
+
+const libraryUsage = `Usage:
+  library [list] [--status watching|completed|dropped] [--search TEXT] [--archived] [--all]
+  library status <number|url> <watching|completed|dropped>
+  library archive <number|url>
+  library unarchive <number|url>
+  library mark <number|url> <episodes>
+  library unmark <number|url> <episodes>
+  library lang <number|url> <sub|dub|raw|-> <languages|->
+
+Numbers refer to the position in 'library list --all'. Episodes are given like 3, 3-7 or 1,4,6-8.
+Unmarking an episode only clears its watched flag, its position is kept.
+'library lang' sets the server type a series tries first and its subtitle languages, comma separated
+names or codes like English,es. '-' falls back to the audio_types and sub_languages config.`
+
+func cmdLibrary(args []string, history []state.History, configSession config.Settings) error {
+	action := "list"
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		action, args = args[0], args[1:]
+	}
+
+	switch action {
+	case "list":
+		return libraryList(args, history)
+	case "status":
+		return libraryEdit(args, 2, history, func(library []state.History, positional []string) ([]state.History, error) {
+			return state.SetStatus(library, positional[0], positional[1])
+		})
+	case "archive", "unarchive":
+		return libraryEdit(args, 1, history, func(library []state.History, positional []string) ([]state.History, error) {
+			return state.SetArchived(library, positional[0], action == "archive")
+		})
+	case "mark", "unmark":
+		return libraryMark(args, history, action == "mark")
+	case "lang":
+		return libraryEdit(args, 3, history, func(library []state.History, positional []string) ([]state.History, error) {
+			audio, languages := positional[1], positional[2]
+			if audio == "-" {
+				audio = ""
+			} else if !slices.Contains(config.AudioTypes, audio) {
+				return library, fmt.Errorf("Unknown audio type '%s', use one of %s", audio, strings.Join(config.AudioTypes, ", "))
+			}
+
+			var subs []string
+			if languages != "-" {
+				for _, lang := range strings.Split(languages, ",") {
+					if lang = strings.TrimSpace(lang); lang != "" {
+						subs = append(subs, lang)
+					}
+				}
+			}
+			return state.SetLanguages(library, positional[0], audio, subs)
+		})
+	case "help":
+		fmt.Println(libraryUsage)
+		return nil
+	}
+
+	fmt.Fprintln(os.Stderr, libraryUsage)
+	return errUsage
+}
+
+func libraryList(args []string, history []state.History) error {
+	fs := newFlagSet("library list")
+	status := fs.String("status", "", "Only show series with this status")
+	search := fs.String("search", "", "Only show series whose name contains this text")
+	archived := fs.Bool("archived", false, "Show archived series instead")
+	all := fs.Bool("all", false, "Show every series, archived or not, numbered as the other library commands expect")
+
+	positional, err := parseInterleaved(fs, args)
+	if err != nil || len(positional) != 0 {
+		return errUsage
+	}
+	if *status != "" && !state.ValidStatus(*status) {
+		return fmt.Errorf("Unknown status '%s'", *status)
+	}
+
+	entries := history
+	if !*all {
+		entries = state.FilterLibrary(history, state.LibraryFilter{Status: *status, Query: *search, Archived: *archived})
+	}
+
+	if ui.Output != ui.OutputText {
+		return ui.PrintRecords("history", entries)
+	}
+	if len(entries) == 0 {
+		fmt.Println("--! No series found in the library")
+		return nil
+	}
+
+	// Show numbers from the full library so they can be used with 'library status' and 'library archive'.
+	ui.PrintLibrary(history, entries)
+	return nil
+}
+
+// libraryEdit applies edit to the library and saves it.
+func libraryEdit(args []string, wantArgs int, history []state.History, edit func([]state.History, []string) ([]state.History, error)) error {
+	positional, err := parseInterleaved(newFlagSet("library"), args)
+	if err != nil || len(positional) != wantArgs {
+		fmt.Fprintln(os.Stderr, libraryUsage)
+		return errUsage
+	}
+
+	_, err = state.UpdateLibrary(func(library []state.History) ([]state.History, error) {
+		return edit(library, positional)
+	})
+	return err
+}
+
+// libraryMark flags episodes as watched or unwatched by hand.
+func libraryMark(args []string, history []state.History, watched bool) error {
+	positional, err := parseInterleaved(newFlagSet("library"), args)
+	if err != nil || len(positional) != 2 {
+		fmt.Fprintln(os.Stderr, libraryUsage)
+		return errUsage
+	}
+	episodes, err := parseEpisodeNumbers(positional[1])
+	if err != nil {
+		return err
+	}
+
+	changed := 0
+	_, err = state.UpdateLibrary(func(library []state.History) ([]state.History, error) {
+		library, changed, err = state.SetWatched(library, positional[0], episodes, watched)
+		return library, err
+	})
+	if err != nil {
+		return err
+	}
+
+	if watched {
+		fmt.Printf("--> Marked %d episode(s) as watched\n", changed)
+	} else {
+		fmt.Printf("--> Marked %d episode(s) as unwatched\n", changed)
+	}
+	return nil
+}
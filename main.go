@@ -1,287 +1,175 @@
 package main
 
 import (
-	"bufio"
 	"flag"
 	"fmt"
-	"math"
 	"os"
-	"strconv"
 	"strings"
+	"time"
 
+	"hianime-mpv-go/anilist"
 	"hianime-mpv-go/config"
 	"hianime-mpv-go/hianime"
-	"hianime-mpv-go/player"
+	"hianime-mpv-go/jimaku"
+	"hianime-mpv-go/paths"
 	"hianime-mpv-go/state"
+	"hianime-mpv-go/tui"
 	"hianime-mpv-go/ui"
+	"hianime-mpv-go/updates"
 )
 
-var cacheEpisodes = make(map[string][]hianime.Episodes) // "AnimeID" : {{Eps: 1, ...}, ...}
-
 func main() {
-	scanner := bufio.NewScanner(os.Stdin)
+	var plainMode bool
+	var selectorMode string
+	var profile string
+	var overrides []string
+	flag.BoolVar(&config.DebugMode, "debug", false, "Enable verbose debug logging")
+	flag.BoolVar(&plainMode, "plain", false, "Use the line based prompts instead of the full-screen interface")
+	flag.StringVar(&selectorMode, "selector", "", "Fuzzy finder for the prompts: auto, fzf, sk or builtin (overrides config)")
+	flag.StringVar(&paths.ConfigFile, "config", "", "Path of the config file (default: $XDG_CONFIG_HOME/hianime-mpv/config.json)")
+	flag.StringVar(&paths.DataDir, "data-dir", "", "Directory for history and other state (default: $XDG_DATA_HOME/hianime-mpv, same as -set data_dir=DIR)")
+	flag.StringVar(&profile, "profile", os.Getenv("HIANIME_PROFILE"), "Profile whose history and settings are used (asked at startup when profiles exist)")
+	flag.Func("set", "Override a setting for this run, e.g. -set timeout=1m (repeatable, see 'config show')", func(pair string) error {
+		overrides = append(overrides, pair)
+		return nil
+	})
+	registerOutputFlags(flag.CommandLine)
+	flag.Usage = printUsage
+	flag.Parse()
 
-	var url string
-	history, err := state.LoadHistory()
+	if err := paths.MigrateConfig(); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to move the old files: "+err.Error())
+	}
+	configFile, err := paths.Config()
 	if err != nil {
-		fmt.Println(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitFailure)
 	}
+	config.FileName = configFile
+
 	configSession, err := config.LoadConfig()
 	if err != nil {
-		fmt.Println("Fail to load config file: " + err.Error())
+		fmt.Fprintln(os.Stderr, "Fail to load config file: "+err.Error())
 	}
 
-	flag.BoolVar(&config.DebugMode, "debug", false, "Enable verbose debug logging")
-	flag.Parse()
-series_loop:
-	for {
-		if len(history) > 0 {
-			fmt.Printf("\n--- Recent History ---\n\n")
-			for i := range history {
-				fmt.Printf(" [%d] %s\n", i+1, history[i].JapaneseName)
-			}
-
-		} else {
-			fmt.Printf("\n--- No recent history found ---\n\n")
-		}
-		fmt.Print("\nEnter number or paste hianime url to play (or 's' to call api search): ")
-		scanner.Scan()
-
-		seriesInput := scanner.Text()
-		if seriesInput == "q" {
-			break series_loop
-		} else if seriesInput == "s" {
-			var searchData []hianime.SearchElements
-			var err error
-			for {
-				fmt.Printf("\nEnter anime name to search (or 'q' to go back):")
-				scanner.Scan()
-				searchInput := scanner.Text()
-				searchData, err = hianime.Search(searchInput)
-				if err != nil {
-					fmt.Println(err)
-				}
+	// The menus ask for the profile, commands use the default one unless told otherwise.
+	if profile == "" && flag.NArg() == 0 && len(configSession.Profiles) > 0 && isTerminal(os.Stdin) {
+		profile = pickProfile(configSession)
+	}
+	if configSession, err = configSession.ForProfile(profile); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitFailure)
+	}
+	if profile != config.DefaultProfile {
+		paths.Profile = profile
+	}
 
-				if len(searchData) != 0 {
-					ui.PrintSeries(searchData)
-					break
-				} else {
-					fmt.Println("--! No anime result found")
-					continue
-				}
-			}
+	// Flags win over the environment, which wins over the file.
+	if selectorMode != "" {
+		overrides = append(overrides, "selector="+selectorMode)
+	}
+	if paths.DataDir != "" {
+		overrides = append(overrides, "data_dir="+paths.DataDir)
+	}
+	if err := configSession.ApplyEnv(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+	if err := configSession.ApplyFlags(overrides); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitUsage)
+	}
+	for _, problem := range configSession.Problems() {
+		fmt.Fprintln(os.Stderr, "--! Config: "+problem.Error())
+	}
+	applySettings(configSession)
 
-			for {
-				fmt.Printf("\nEnter anime number to play: ")
-				scanner.Scan()
+	// After the settings, so the files go to the data_dir of the config or profile.
+	if err := paths.MigrateState(); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to move the old files: "+err.Error())
+	}
 
-				usrInput := scanner.Text()
-				usrInputInt, err := strconv.Atoi(strings.TrimSpace(usrInput))
-				if err != nil {
-					fmt.Println("Failed to convert to integer. Input number.")
-					continue
-				}
+	if err := state.OpenStore(configSession.Storage); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitFailure)
+	}
+	history, err := state.LoadHistory()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
 
-				seriesInput = searchData[usrInputInt-1].Url
-				fmt.Println(url)
-				break
-			}
+	if flag.NArg() > 0 {
+		c, ok := findCommand(flag.Arg(0))
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Unknown command '%s'\n\n", flag.Arg(0))
+			printUsage()
+			os.Exit(exitUsage)
 		}
-
-		var historySelect state.History
-		var seriesMetadata hianime.SeriesData
-
-		if strings.Contains(seriesInput, "hianime.to") {
-			url = seriesInput
-			seriesMetadata = hianime.GetSeriesData(url)
-			newHistory := state.History{
-				Url:          seriesMetadata.SeriesUrl,
-				JapaneseName: seriesMetadata.JapaneseName,
-				EnglishName:  seriesMetadata.EnglishName,
-				AnilistID:    seriesMetadata.AnilistID,
-				LastEpisode:  1,
-				Episode:      make(map[int]state.EpisodeProgress),
-			}
-			historySelect = newHistory
-
-			history = state.UpdateHistory(history, newHistory)
-			state.SaveHistory(history)
-		} else {
-			if seriesInput == "q" {
-				continue
-			}
-
-			seriesInputInt, err := strconv.Atoi(seriesInput)
-			if err != nil {
-				fmt.Println("Failed to convert to integer. Input number or paste url")
-				continue
-			}
-
-			historySelect = history[seriesInputInt-1]
-			url = historySelect.Url
-
-			seriesMetadata = hianime.GetSeriesData(url)
-
-			history = state.UpdateHistory(history, historySelect)
-			state.SaveHistory(history)
+		if c.name == "sync" {
+			os.Exit(runCommand(c, flag.Args()[1:], history, configSession))
 		}
+		history = syncOnStartup(history, configSession)
+		code := runCommand(c, flag.Args()[1:], history, configSession)
+		syncOnExit(configSession)
+		os.Exit(code)
+	}
 
-	episode_loop:
-		for {
-			fmt.Printf("\n--- Series: %s ---\n\n", seriesMetadata.JapaneseName)
-
-			episodeCache, exists := cacheEpisodes[seriesMetadata.AnimeID]
-			if !exists {
-				episodeCache = hianime.GetEpisodes(seriesMetadata.AnimeID)
-				cacheEpisodes[seriesMetadata.AnimeID] = episodeCache
-			}
-
-			ui.PrintEpisodes(episodeCache, historySelect)
-
-			fmt.Print("\nEnter number episode to watch (or 'q' to go back): ")
-			scanner.Scan()
-
-			episodeInput := scanner.Text()
-			episodeInput = strings.TrimSpace(episodeInput)
-
-			if episodeInput == "q" {
-				break episode_loop
-			}
-
-			var selectedNum int
-			var err error
-			if episodeInput == "" {
-				selectedNum = historySelect.LastEpisode
+	history = syncOnStartup(history, configSession)
+	defer syncOnExit(configSession)
 
-			} else {
-				selectedNum, err = strconv.Atoi(episodeInput)
-				if err != nil {
-					fmt.Printf("Invaild number: %s", err.Error())
-					continue
+	if plainMode || !isTerminal(os.Stdout) {
+		if configSession.CheckOnStartup {
+			if followed := updates.Followed(history); len(followed) > 0 {
+				ui.PrintNewEpisodes(checkSeries(followed, updates.DefaultWorkers))
+				if reloaded, err := state.LoadHistory(); err == nil {
+					history = reloaded
 				}
 			}
+		}
+		runPrompt(history, configSession)
+		return
+	}
 
-			var servers []hianime.ServerList
-
-			var selectedEpisode hianime.Episodes
-			if selectedNum > 0 && selectedNum <= len(episodeCache) {
-				selectedEpisode = episodeCache[selectedNum-1]
-				servers = hianime.GetEpisodeServerId(selectedEpisode.Id)
-
-				historySelect.LastEpisode = selectedNum
-
-				history = state.UpdateHistory(history, historySelect)
-				state.SaveHistory(history)
-			} else {
-				fmt.Println("Number is invalid.")
-				continue
-			}
-
-			var testedServer int
-		server_loop:
-			for {
-				if len(servers) == 0 {
-					fmt.Println("\nNo available servers found.")
-					break
-				}
-
-				var selectedServer hianime.ServerList
-				var streamData hianime.StreamData
-
-				if configSession.AutoSelectServer {
-					if testedServer >= len(servers) {
-						fmt.Println("\nNo available servers found for following episode.")
-						break
-					}
-
-					fmt.Println("\n--> Auto-select server enabled.")
-
-					for i := testedServer; i < len(servers); i++ {
-						selectedServer = servers[i]
-
-						fmt.Printf("--> Selecting '%s'....\n", selectedServer.Name)
-
-						attempt, err := hianime.GetStreamData(selectedServer.DataId)
-						if err == nil {
-							streamData = attempt
-							testedServer = i + 1
-							break
-						}
-					}
-
-				} else {
-					fmt.Print("\n--- Available Servers ---\n")
-
-					for i := range len(servers) {
-						serverIns := servers[i]
-
-						if serverIns.Type == "dub" {
-							fmt.Printf(" [%d] %s (Dub)\n", i+1, serverIns.Name)
-						} else {
-							fmt.Printf(" [%d] %s\n", i+1, serverIns.Name)
-						}
-					}
-					fmt.Print("\nEnter server number (or 'q' to go back): ")
-					scanner.Scan()
-
-					serverInput := scanner.Text()
-					serverInput = strings.TrimSpace(serverInput)
-
-					if serverInput == "q" {
-						break server_loop
-					}
-					serverInputInt, err := strconv.Atoi(serverInput)
-					if err != nil {
-						fmt.Printf("Error when converting to int: %s\n", err.Error())
-						continue
-					}
-
-					if serverInputInt > 0 && serverInputInt <= len(servers) {
-						selectedServer = servers[serverInputInt-1]
-
-						attempt, err := hianime.GetStreamData(selectedServer.DataId)
-						if err == nil {
-							streamData = attempt
-							fmt.Println(streamData)
-						}
-					} else {
-						fmt.Println("Number is invalid.")
-						continue
-					}
-				}
-
-				if streamData.Url == "" {
-					fmt.Println("Couldn't find streamdata url!")
-					continue
-				}
-
-				// get mpv path automatically according user platforms.
-				binName := player.GetMpvBinary(configSession.MpvPath)
-				desktopCommands := player.BuildDesktopCommands(seriesMetadata, selectedEpisode, selectedServer, streamData, historySelect, configSession)
-
-				success, subDelay, lastPos, totalDur := player.PlayMpv(binName, desktopCommands)
-
-				if success {
-					cleanDelay := math.Round(subDelay*10) / 10
-					historySelect.SubDelay = cleanDelay
+	if err := tui.Run(history, configSession); err != nil {
+		fmt.Println("Failed to run the interface: " + err.Error())
+		syncOnExit(configSession)
+		os.Exit(1)
+	}
+}
 
-					if historySelect.Episode == nil {
-						historySelect.Episode = make(map[int]state.EpisodeProgress)
-					}
+// applySettings hands the settings read by other packages over to them.
+func applySettings(configSession config.Settings) {
+	paths.DataDir = configSession.DataDir
+	paths.CacheDir = configSession.CacheDir
 
-					historySelect.Episode[selectedEpisode.Number] = state.EpisodeProgress{
-						Position: lastPos,
-						Duration: totalDur,
-					}
+	if configSession.BaseURL != "" {
+		hianime.BaseUrl = strings.TrimRight(configSession.BaseURL, "/")
+	}
+	if configSession.JimakuURL != "" {
+		jimaku.JimakuBaseUrl = strings.TrimRight(configSession.JimakuURL, "/")
+	}
+	jimaku.JimakuApi = configSession.JimakuAPIKey
+	hianime.DecryptKey = configSession.DecryptKey
+	hianime.DecryptKeyURL = configSession.DecryptKeyURL
+
+	if configSession.Timeout != "" {
+		// An invalid timeout is reported by Problems and the default is kept.
+		if timeout, err := time.ParseDuration(configSession.Timeout); err == nil && timeout > 0 {
+			hianime.Client.Timeout = timeout
+			jimaku.Client.Timeout = timeout
+		}
+	}
 
-					history = state.UpdateHistory(history, historySelect)
-					state.SaveHistory(history)
+	anilist.Configure(configSession.Anilist.Token)
+	if t := configSession.WatchedThreshold; t > 0 && t <= 1 {
+		state.WatchedThreshold = t
+	}
+}
 
-					break server_loop
-				} else {
-					continue
-				}
-			}
-		}
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
 	}
+	return info.Mode()&os.ModeCharDevice != 0
 }
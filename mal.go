@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"hianime-mpv-go/anilist"
+	"hianime-mpv-go/config"
+	"hianime-mpv-go/mal"
+	"hianime-mpv-go/safefile"
+	"hianime-mpv-go/state"
+)
+
+const malUsage = `Usage:
+  mal export [--output FILE]      Write the library and the watchlist as a MyAnimeList XML export
+  mal import <file> [--search]    Seed the library and the watchlist from a MyAnimeList XML export
+
+Series are matched by their MyAnimeList id, or their AniList id. With --search, series that aren't
+in the library are looked up on hianime by title. Series without a MyAnimeList id can't be exported.`
+
+func cmdMal(args []string, history []state.History, configSession config.Settings) error {
+	action := ""
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		action, args = args[0], args[1:]
+	}
+
+	switch action {
+	case "export":
+		return malExport(args, history)
+	case "import":
+		return malImport(args)
+	case "help":
+		fmt.Println(malUsage)
+		return nil
+	}
+
+	fmt.Fprintln(os.Stderr, malUsage)
+	return errUsage
+}
+
+func malExport(args []string, history []state.History) error {
+	fs := newFlagSet("mal export")
+	output := fs.String("output", "", "File to write the export to (defaults to stdout)")
+
+	positional, err := parseInterleaved(fs, args)
+	if err != nil || len(positional) != 0 {
+		return errUsage
+	}
+
+	watchlist, err := state.LoadWatchlist()
+	if err != nil {
+		return err
+	}
+	list, skipped := mal.Export(history, watchlist)
+
+	if *output == "" {
+		err = mal.Write(stdout, list)
+	} else {
+		err = writeExport(*output, list)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(skipped) > 0 {
+		fmt.Fprintf(os.Stderr, "--! %d series without a MyAnimeList id were left out (open them once to fill it in):\n", len(skipped))
+		for _, name := range skipped {
+			fmt.Fprintf(os.Stderr, "    %s\n", name)
+		}
+	}
+	if *output != "" {
+		fmt.Printf("--> Exported %d series to %s\n", len(list.Anime), *output)
+	}
+	return nil
+}
+
+func writeExport(path string, list mal.List) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, safefile.Perm)
+	if err != nil {
+		return fmt.Errorf("Failed to create %s: %w", path, err)
+	}
+
+	if err := mal.Write(file, list); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+func malImport(args []string) error {
+	fs := newFlagSet("mal import")
+	search := fs.Bool("search", false, "Look series that aren't in the library up on hianime")
+
+	positional, err := parseInterleaved(fs, args)
+	if err != nil || len(positional) != 1 {
+		return errUsage
+	}
+
+	list, err := mal.ReadFile(positional[0])
+	if err != nil {
+		return err
+	}
+
+	client := anilist.Default
+	if client == nil {
+		client = anilist.NewClient("")
+	}
+	lookup := mal.Lookup{
+		AnilistIDs: func(malIDs []int) (map[int]int, error) {
+			ids, err := client.AnilistIDs(malIDs)
+			if err != nil {
+				// Matching by MyAnimeList id still works without it.
+				fmt.Fprintf(os.Stderr, "--! Failed to match series by AniList id: %v\n", err)
+			}
+			return ids, nil
+		},
+	}
+	if *search {
+		lookup.Search = mal.SearchHianime
+	}
+
+	report, err := mal.Import(list, lookup)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("--> %d series updated, %d added to the library, %d added to the watchlist\n",
+		report.Updated, report.Added, report.Watchlisted)
+	if len(report.Unmatched) > 0 {
+		fmt.Printf("--! %d entries matched no series:\n", len(report.Unmatched))
+		for _, title := range report.Unmatched {
+			fmt.Printf("    %s\n", title)
+		}
+		if !*search {
+			fmt.Println("--! Run again with --search to look them up on hianime")
+		}
+	}
+	return nil
+}
@@ -0,0 +1,99 @@
+package mal
+
+import (
+	"strconv"
+	"time"
+
+	"hianime-mpv-go/state"
+)
+
+// Export builds a MyAnimeList list from the library and the watchlist. Series without a MyAnimeList id can't be
+// imported there, they are left out and their names returned in skipped.
+func Export(library []state.History, watchlist []state.WatchlistEntry) (List, []string) {
+	list := List{MyInfo: MyInfo{UserExportType: 1}}
+	var skipped []string
+
+	for _, h := range library {
+		id, err := strconv.Atoi(h.MalID)
+		if err != nil || id <= 0 {
+			skipped = append(skipped, seriesName(h.JapaneseName, h.EnglishName, h.Url))
+			continue
+		}
+
+		watched := 0
+		var first, last time.Time
+		for num, prog := range h.Episode {
+			if !prog.Finished() {
+				continue
+			}
+			if num > watched {
+				watched = num
+			}
+			if first.IsZero() || (!prog.FirstWatchedAt.IsZero() && prog.FirstWatchedAt.Before(first)) {
+				first = prog.FirstWatchedAt
+			}
+			if prog.LastWatchedAt.After(last) {
+				last = prog.LastWatchedAt
+			}
+		}
+
+		status := FromLibraryStatus(h.GetStatus())
+		finish := time.Time{}
+		if status == StatusCompleted {
+			finish = last
+		}
+
+		list.Anime = append(list.Anime, Anime{
+			ID:              id,
+			Title:           cdata{Text: h.JapaneseName},
+			Episodes:        h.KnownEpisodes,
+			WatchedEpisodes: watched,
+			StartDate:       formatDate(first),
+			FinishDate:      formatDate(finish),
+			Status:          status,
+			UpdateOnImport:  1,
+		})
+	}
+
+	for _, w := range watchlist {
+		id, err := strconv.Atoi(w.MalID)
+		if err != nil || id <= 0 {
+			skipped = append(skipped, seriesName(w.JapaneseName, w.EnglishName, w.SeriesUrl))
+			continue
+		}
+
+		list.Anime = append(list.Anime, Anime{
+			ID:             id,
+			Title:          cdata{Text: w.JapaneseName},
+			StartDate:      noDate,
+			FinishDate:     noDate,
+			Status:         StatusPlanToWatch,
+			UpdateOnImport: 1,
+		})
+	}
+
+	list.MyInfo.TotalAnime = len(list.Anime)
+	return list, skipped
+}
+
+// seriesName is the first of the names of a series that is set.
+func seriesName(names ...string) string {
+	for _, name := range names {
+		if name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return noDate
+	}
+	return t.Local().Format("2006-01-02")
+}
+
+func parseDate(date string) (time.Time, bool) {
+	t, err := time.ParseInLocation("2006-01-02", date, time.Local)
+	return t, err == nil
+}
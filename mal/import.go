@@ -0,0 +1,194 @@
+package mal
+
+import (
+	"strconv"
+	"time"
+
+	"hianime-mpv-go/hianime"
+	"hianime-mpv-go/state"
+)
+
+// searchCandidates is how many search results are opened to find the one with the right MyAnimeList id.
+const searchCandidates = 3
+
+// Lookup finds the series of list entries that the library and the watchlist don't know by id. Nil fields are skipped.
+type Lookup struct {
+	// AnilistIDs maps MyAnimeList ids to AniList ids, to match series only stored with their AniList id.
+	AnilistIDs func(malIDs []int) (map[int]int, error)
+	// Search looks the title up on hianime and returns the series with the given MyAnimeList id.
+	Search func(title string, malID int) (hianime.SeriesData, bool)
+}
+
+// Report sums up an import.
+type Report struct {
+	Updated     int      // library series that took the imported progress
+	Added       int      // series added to the library
+	Watchlisted int      // "Plan to Watch" entries added to the watchlist
+	Unmatched   []string // titles no series was found for
+}
+
+// Import seeds the library and the watchlist from a MyAnimeList list. Entries are matched to series by their
+// MyAnimeList id, then by AniList id, then through lookup.Search. "Plan to Watch" entries go to the watchlist,
+// the others to the library with their status and watched episodes.
+func Import(list List, lookup Lookup) (Report, error) {
+	var report Report
+
+	library, err := state.LoadHistory()
+	if err != nil {
+		return report, err
+	}
+	watchlist, err := state.LoadWatchlist()
+	if err != nil {
+		return report, err
+	}
+
+	anilistIDs := make(map[int]int)
+	if lookup.AnilistIDs != nil {
+		ids := make([]int, 0, len(list.Anime))
+		for _, a := range list.Anime {
+			ids = append(ids, a.ID)
+		}
+		if anilistIDs, err = lookup.AnilistIDs(ids); err != nil {
+			return report, err
+		}
+	}
+
+	matches := func(malID, anilistID string, a Anime) bool {
+		if malID != "" && malID == strconv.Itoa(a.ID) {
+			return true
+		}
+		return anilistID != "" && anilistIDs[a.ID] != 0 && anilistID == strconv.Itoa(anilistIDs[a.ID])
+	}
+
+	// The lookups run first, so the store is only locked for the edits.
+	updates := make(map[string]Anime)
+	var added []state.History
+	var toWatchlist []hianime.SeriesData
+
+next:
+	for _, a := range list.Anime {
+		status := NormalizeStatus(a.Status)
+
+		for _, h := range library {
+			if matches(h.MalID, h.AnilistID, a) {
+				updates[h.Key()] = a
+				continue next
+			}
+		}
+
+		var metaData hianime.SeriesData
+		found := false
+		for _, w := range watchlist {
+			if matches(w.MalID, w.AnilistID, a) {
+				if status == StatusPlanToWatch {
+					continue next
+				}
+				metaData, found = w.SeriesData, true
+				break
+			}
+		}
+		if !found && lookup.Search != nil {
+			metaData, found = lookup.Search(a.Title.Text, a.ID)
+		}
+		if !found {
+			report.Unmatched = append(report.Unmatched, a.Title.Text)
+			continue
+		}
+
+		if metaData.MalID == "" {
+			metaData.MalID = strconv.Itoa(a.ID)
+		}
+		if status == StatusPlanToWatch {
+			toWatchlist = append(toWatchlist, metaData)
+			continue
+		}
+
+		h := state.NewHistory(metaData)
+		applyAnime(&h, a)
+		added = append(added, h)
+	}
+
+	_, err = state.UpdateLibrary(func(library []state.History) ([]state.History, error) {
+		for i := range library {
+			if a, ok := updates[library[i].Key()]; ok {
+				applyAnime(&library[i], a)
+				report.Updated++
+			}
+		}
+
+		// Added at the end, so the recent history stays as it is.
+		for _, h := range added {
+			if _, exists := findKey(library, h.Key()); !exists {
+				library = append(library, h)
+				report.Added++
+			}
+		}
+		return library, nil
+	})
+	if err != nil {
+		return report, err
+	}
+
+	_, err = state.UpdateWatchlist(func(watchlist []state.WatchlistEntry) ([]state.WatchlistEntry, error) {
+		// Series that moved to the library leave the watchlist.
+		var kept []state.WatchlistEntry
+		for _, w := range watchlist {
+			if _, moved := findKey(added, w.Key()); !moved {
+				kept = append(kept, w)
+			}
+		}
+
+		for _, metaData := range toWatchlist {
+			if updated, err := state.AddToWatchlist(kept, metaData); err == nil {
+				kept = updated
+				report.Watchlisted++
+			}
+		}
+		return kept, nil
+	})
+	return report, err
+}
+
+func applyAnime(h *state.History, a Anime) {
+	h.Status = ToLibraryStatus(a.Status)
+	if a.ID > 0 {
+		h.MalID = strconv.Itoa(a.ID)
+	}
+
+	watchedAt := time.Now()
+	if t, ok := parseDate(a.FinishDate); ok {
+		watchedAt = t
+	} else if t, ok := parseDate(a.StartDate); ok {
+		watchedAt = t
+	}
+	h.MarkWatchedThrough(a.WatchedEpisodes, watchedAt)
+}
+
+func findKey(library []state.History, key string) (int, bool) {
+	for i := range library {
+		if library[i].Key() == key {
+			return i, true
+		}
+	}
+	return -1, false
+}
+
+// SearchHianime is the Lookup.Search of the program: it opens the first search results for title
+// and returns the one whose MyAnimeList id is malID.
+func SearchHianime(title string, malID int) (hianime.SeriesData, bool) {
+	results, err := hianime.Search(title)
+	if err != nil {
+		return hianime.SeriesData{}, false
+	}
+
+	for i, r := range results {
+		if i == searchCandidates {
+			break
+		}
+		metaData, err := hianime.FetchSeriesData(r.Url)
+		if err == nil && metaData.MalID == strconv.Itoa(malID) {
+			return metaData, true
+		}
+	}
+	return hianime.SeriesData{}, false
+}
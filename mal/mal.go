@@ -0,0 +1,123 @@
+// Package mal reads and writes the XML list export of MyAnimeList, so the history can move between the two.
+package mal
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"hianime-mpv-go/state"
+)
+
+// MyAnimeList statuses, as written by its export.
+const (
+	StatusWatching    = "Watching"
+	StatusCompleted   = "Completed"
+	StatusOnHold      = "On-Hold"
+	StatusDropped     = "Dropped"
+	StatusPlanToWatch = "Plan to Watch"
+)
+
+// noDate is how the export writes a missing date.
+const noDate = "0000-00-00"
+
+type List struct {
+	XMLName xml.Name `xml:"myanimelist"`
+	MyInfo  MyInfo   `xml:"myinfo"`
+	Anime   []Anime  `xml:"anime"`
+}
+
+type MyInfo struct {
+	UserExportType int `xml:"user_export_type"` // 1 is anime
+	TotalAnime     int `xml:"user_total_anime"`
+}
+
+type Anime struct {
+	ID              int    `xml:"series_animedb_id"`
+	Title           cdata  `xml:"series_title"`
+	Episodes        int    `xml:"series_episodes"`
+	WatchedEpisodes int    `xml:"my_watched_episodes"`
+	StartDate       string `xml:"my_start_date"`
+	FinishDate      string `xml:"my_finish_date"`
+	Status          string `xml:"my_status"`
+	UpdateOnImport  int    `xml:"update_on_import"`
+}
+
+type cdata struct {
+	Text string `xml:",cdata"`
+}
+
+// NormalizeStatus turns the statuses of older exports, which use numbers, into their names.
+func NormalizeStatus(status string) string {
+	switch strings.TrimSpace(status) {
+	case "1":
+		return StatusWatching
+	case "2":
+		return StatusCompleted
+	case "3":
+		return StatusOnHold
+	case "4":
+		return StatusDropped
+	case "6":
+		return StatusPlanToWatch
+	}
+	return strings.TrimSpace(status)
+}
+
+// FromLibraryStatus maps a library status to the MyAnimeList one.
+func FromLibraryStatus(status string) string {
+	switch status {
+	case state.StatusCompleted:
+		return StatusCompleted
+	case state.StatusDropped:
+		return StatusDropped
+	}
+	return StatusWatching
+}
+
+// ToLibraryStatus maps a MyAnimeList status to the library one. On-hold series count as watching.
+func ToLibraryStatus(status string) string {
+	switch NormalizeStatus(status) {
+	case StatusCompleted:
+		return state.StatusCompleted
+	case StatusDropped:
+		return state.StatusDropped
+	}
+	return state.StatusWatching
+}
+
+func Read(r io.Reader) (List, error) {
+	var list List
+	if err := xml.NewDecoder(r).Decode(&list); err != nil {
+		return list, fmt.Errorf("Failed to read the MyAnimeList export: %w", err)
+	}
+	return list, nil
+}
+
+func ReadFile(path string) (List, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return List{}, fmt.Errorf("Failed to open %s: %w", path, err)
+	}
+	defer file.Close()
+
+	return Read(file)
+}
+
+func Write(w io.Writer, list List) error {
+	data, err := xml.MarshalIndent(list, "", "\t")
+	if err != nil {
+		return fmt.Errorf("Failed to encode the MyAnimeList export: %w", err)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,117 @@
+package paths
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// legacyStateFiles are the files older versions kept in ./state.
+var legacyStateFiles = []string{"history.json", "history.db", "episodes.json", "settings.json", "downloads.json"}
+
+// The files older versions kept in the working directory, ./config.json and the files in ./state, are moved to
+// their new places by MigrateConfig and MigrateState. Files already present at the destination win, so they only
+// do something the first time, and nothing when the new locations are the working directory itself.
+
+// MigrateConfig moves ./config.json. It runs before the config is loaded.
+func MigrateConfig() error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("Failed to get working directory: %w", err)
+	}
+
+	configPath, err := Config()
+	if err != nil {
+		return err
+	}
+	if legacyConfig := filepath.Join(cwd, configName); legacyConfig != configPath {
+		for _, suffix := range []string{"", ".bak"} {
+			if err := moveFile(legacyConfig+suffix, configPath+suffix); err != nil {
+				return err
+			}
+		}
+		// Lock files are recreated at the new place.
+		os.Remove(legacyConfig + ".lock")
+	}
+	return nil
+}
+
+// MigrateState moves the files in ./state. It runs once the settings are applied, so DataDir is final.
+func MigrateState() error {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("Failed to get working directory: %w", err)
+	}
+
+	// Only the files older versions wrote are moved. A checkout of this repository has a state/ directory too.
+	legacyState := filepath.Join(cwd, "state")
+	dataPath, err := dataDir()
+	if err != nil || dataPath == legacyState {
+		return err
+	}
+	for _, name := range legacyStateFiles {
+		for _, suffix := range []string{"", ".bak"} {
+			if err := moveFile(filepath.Join(legacyState, name+suffix), filepath.Join(dataPath, name+suffix)); err != nil {
+				return err
+			}
+		}
+		// Lock files are recreated at the new place.
+		os.Remove(filepath.Join(legacyState, name+".lock"))
+	}
+
+	// Only removed when empty, anything left over stays where the user can find it.
+	os.Remove(legacyState)
+	return nil
+}
+
+func moveFile(from, to string) error {
+	if from == to {
+		return nil
+	}
+	if _, err := os.Stat(from); os.IsNotExist(err) {
+		return nil
+	}
+	if _, err := os.Stat(to); err == nil {
+		return nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(to), 0755); err != nil {
+		return fmt.Errorf("Failed to find/create directory: %w", err)
+	}
+
+	// Rename fails across filesystems, copy and remove instead.
+	if err := os.Rename(from, to); err != nil {
+		if err := copyFile(from, to); err != nil {
+			return fmt.Errorf("Failed to move %s to %s: %w", from, to, err)
+		}
+		os.Remove(from)
+	}
+
+	fmt.Printf("--> Moved %s to %s\n", from, to)
+	return nil
+}
+
+func copyFile(from, to string) error {
+	in, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+
+	out, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(to)
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,137 @@
+// Package paths resolves where the config, state and cache files live, following the XDG base directory spec.
+//
+// Every directory can be overridden, in order of precedence, by the settings (ConfigFile, DataDir, CacheDir, set
+// from flags, the environment or the config file), an environment variable (HIANIME_CONFIG, HIANIME_DATA_DIR,
+// HIANIME_CACHE_DIR), the XDG variables, and finally the platform default from the os package.
+package paths
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+)
+
+// AppName is the directory created inside each base directory.
+const AppName = "hianime-mpv"
+
+const configName = "config.json"
+
+// Set from the --config flag and the data_dir and cache_dir settings. Empty means resolve normally.
+var (
+	ConfigFile string
+	DataDir    string
+	CacheDir   string
+)
+
+// Profile is the profile in use. Every profile but the default one, "", keeps its state in its own
+// directory inside the data directory.
+var Profile string
+
+// Config returns the path of the config file.
+func Config() (string, error) {
+	if ConfigFile != "" {
+		return filepath.Abs(ConfigFile)
+	}
+	if file := os.Getenv("HIANIME_CONFIG"); file != "" {
+		return filepath.Abs(file)
+	}
+
+	base := os.Getenv("XDG_CONFIG_HOME")
+	if base == "" {
+		var err error
+		if base, err = os.UserConfigDir(); err != nil {
+			return "", fmt.Errorf("Failed to find the config directory: %w", err)
+		}
+	}
+	return filepath.Join(base, AppName, configName), nil
+}
+
+// Data returns the directory for history, the episode cache database and other state of the profile in use,
+// creating it if needed.
+func Data() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	if Profile != "" {
+		dir = ProfileDir(dir, Profile)
+	}
+	return ensure(dir)
+}
+
+// ProfileDir returns the state directory of a profile inside the data directory base.
+func ProfileDir(base, profile string) string {
+	return filepath.Join(base, "profiles", profile)
+}
+
+func dataDir() (string, error) {
+	if DataDir != "" {
+		return filepath.Abs(DataDir)
+	}
+	if dir := os.Getenv("HIANIME_DATA_DIR"); dir != "" {
+		return filepath.Abs(dir)
+	}
+
+	if base := os.Getenv("XDG_DATA_HOME"); base != "" {
+		return filepath.Join(base, AppName), nil
+	}
+	// Windows and macOS keep data next to the config, in %AppData% and ~/Library/Application Support.
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		base, err := os.UserConfigDir()
+		if err != nil {
+			return "", fmt.Errorf("Failed to find the data directory: %w", err)
+		}
+		return filepath.Join(base, AppName), nil
+	}
+
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("Failed to find the data directory: %w", err)
+	}
+	return filepath.Join(home, ".local", "share", AppName), nil
+}
+
+// Cache returns the directory for files that can be downloaded again, like subtitles, creating it if needed.
+func Cache() (string, error) {
+	if CacheDir != "" {
+		return ensure(CacheDir)
+	}
+	if dir := os.Getenv("HIANIME_CACHE_DIR"); dir != "" {
+		return ensure(dir)
+	}
+
+	base := os.Getenv("XDG_CACHE_HOME")
+	if base == "" {
+		var err error
+		if base, err = os.UserCacheDir(); err != nil {
+			return "", fmt.Errorf("Failed to find the cache directory: %w", err)
+		}
+	}
+	return ensure(filepath.Join(base, AppName))
+}
+
+// Scripts returns the directory for the mpv scripts, inside the data directory. Profiles share it.
+func Scripts() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return ensure(filepath.Join(dir, "scripts"))
+}
+
+// Subtitles returns the directory for downloaded subtitles, inside the cache directory.
+func Subtitles() (string, error) {
+	dir, err := Cache()
+	if err != nil {
+		return "", err
+	}
+	return ensure(filepath.Join(dir, "subtitles"))
+}
+
+func ensure(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("Failed to find/create directory: %w", err)
+	}
+	return dir, nil
+}
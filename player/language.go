@@ -0,0 +1,123 @@
+package player
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"hianime-mpv-go/config"
+	"hianime-mpv-go/hianime"
+	"hianime-mpv-go/state"
+)
+
+// languageCodes maps the language names hianime labels its subtitles with to the codes mpv matches
+// with --slang and --alang.
+var languageCodes = map[string][]string{
+	"arabic":     {"ar", "ara"},
+	"chinese":    {"zh", "chi", "zho"},
+	"english":    {"en", "eng"},
+	"french":     {"fr", "fre", "fra"},
+	"german":     {"de", "ger", "deu"},
+	"indonesian": {"id", "ind"},
+	"italian":    {"it", "ita"},
+	"japanese":   {"ja", "jpn"},
+	"korean":     {"ko", "kor"},
+	"malay":      {"ms", "may", "msa"},
+	"polish":     {"pl", "pol"},
+	"portuguese": {"pt", "por"},
+	"russian":    {"ru", "rus"},
+	"spanish":    {"es", "spa"},
+	"thai":       {"th", "tha"},
+	"turkish":    {"tr", "tur"},
+	"vietnamese": {"vi", "vie"},
+}
+
+// Preferences returns the audio types and subtitle languages to use for a series, most wanted first: the series'
+// own choices, then the config. Without sub_languages, english_only keeps only the English subtitles.
+// No subtitle languages means every subtitle is loaded.
+func Preferences(configData config.Settings, historyData state.History) ([]string, []string) {
+	var audio []string
+	if historyData.AudioType != "" {
+		audio = append(audio, historyData.AudioType)
+	}
+	for _, a := range configData.AudioTypes {
+		if !slices.Contains(audio, a) {
+			audio = append(audio, a)
+		}
+	}
+
+	subs := historyData.SubLanguages
+	if len(subs) == 0 {
+		subs = configData.SubLanguages
+	}
+	if len(subs) == 0 && configData.EnglishOnly {
+		subs = []string{"English"}
+	}
+	return audio, subs
+}
+
+// subtitleRank returns the position in languages of the language of a subtitle label like "English" or
+// "Portuguese - Brazilian", or -1 when it isn't wanted. Languages are given by name or code.
+func subtitleRank(label string, languages []string) int {
+	label = strings.ToLower(strings.TrimSpace(label))
+	name, _, _ := strings.Cut(label, " ")
+	codes := languageCodes[name]
+
+	for i, lang := range languages {
+		lang = strings.ToLower(strings.TrimSpace(lang))
+		if lang == "" {
+			continue
+		}
+		if label == lang || name == lang || strings.HasPrefix(label, lang+" ") || slices.Contains(codes, lang) {
+			return i
+		}
+	}
+	return -1
+}
+
+// SubtitleTracks returns the subtitle tracks to load, the most wanted language first.
+// With no languages every subtitle is kept, in the order of the stream.
+func SubtitleTracks(tracks []hianime.Track, languages []string) []hianime.Track {
+	var subs []hianime.Track
+	for _, track := range tracks {
+		if track.Kind == "thumbnails" {
+			continue
+		}
+		if len(languages) > 0 && subtitleRank(track.Label, languages) < 0 {
+			continue
+		}
+		subs = append(subs, track)
+	}
+
+	sort.SliceStable(subs, func(a, b int) bool {
+		return subtitleRank(subs[a].Label, languages) < subtitleRank(subs[b].Label, languages)
+	})
+	return subs
+}
+
+// LanguageCodes turns languages given by name or code into the codes mpv expects, keeping their order.
+func LanguageCodes(languages []string) []string {
+	var codes []string
+	for _, lang := range languages {
+		lang = strings.ToLower(strings.TrimSpace(lang))
+		name, _, _ := strings.Cut(lang, " ")
+		found := languageCodes[name]
+		if found == nil {
+			found = []string{lang}
+		}
+		for _, code := range found {
+			if !slices.Contains(codes, code) {
+				codes = append(codes, code)
+			}
+		}
+	}
+	return codes
+}
+
+// AudioLanguages returns the audio languages of a server type: dubs are in English, the rest in Japanese.
+func AudioLanguages(serverType string) []string {
+	if serverType == "dub" {
+		return languageCodes["english"]
+	}
+	return languageCodes["japanese"]
+}
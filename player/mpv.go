@@ -15,6 +15,7 @@ import (
 	"hianime-mpv-go/config"
 	"hianime-mpv-go/hianime"
 	"hianime-mpv-go/jimaku"
+	"hianime-mpv-go/paths"
 	"hianime-mpv-go/state"
 	"hianime-mpv-go/ui"
 )
@@ -30,7 +31,7 @@ func BuildDesktopCommands(metaData hianime.SeriesData, episodeData hianime.Episo
 	headerFields := []string{
 		fmt.Sprintf("Referer: %s", streamingData.Referer),
 		fmt.Sprintf("User-Agent: %s", streamingData.UserAgent),
-		fmt.Sprintf("Origin: %s", "https://megacloud.blog"),
+		fmt.Sprintf("Origin: %s", streamOrigin(streamingData)),
 	}
 	fullHeaders := strings.Join(headerFields, ",")
 
@@ -43,10 +44,10 @@ func BuildDesktopCommands(metaData hianime.SeriesData, episodeData hianime.Episo
 		"--script-opts-append=osc-title=${title}",
 	}
 
-	// last position if exist in history
-	episodeProgress, exist := historyData.Episode[episodeData.Number]
-	if exist {
-		args = append(args, fmt.Sprintf("--start=%f", episodeProgress.Position))
+	// start position according to the resume mode, watched episodes are rewatched from the start
+	start := StartPosition(ResumeMode(configData), historyData.Episode[episodeData.Number], streamingData.Intro)
+	if start > 0 {
+		args = append(args, fmt.Sprintf("--start=%f", start))
 	}
 
 	// Chapter command
@@ -77,17 +78,15 @@ func BuildDesktopCommands(metaData hianime.SeriesData, episodeData hianime.Episo
 		fmt.Printf("--> Skipping Jimaku\n")
 	}
 
-	// Subs from hianime
-	for _, track := range streamingData.Tracks {
-		if track.Kind == "thumbnails" {
-			continue
-		}
-		if configData.EnglishOnly && track.Label != "English" {
-			continue
-		}
-
+	// Subs from hianime, in the preferred languages
+	_, subLanguages := Preferences(configData, historyData)
+	for _, track := range SubtitleTracks(streamingData.Tracks, subLanguages) {
 		args = append(args, fmt.Sprintf("--sub-file=%s", track.File))
 	}
+	if codes := LanguageCodes(subLanguages); len(codes) > 0 {
+		args = append(args, "--slang="+strings.Join(codes, ","))
+	}
+	args = append(args, "--alang="+strings.Join(AudioLanguages(serverData.Type), ","))
 
 	// Sub delay history command
 	if historyData.SubDelay != 0 {
@@ -95,6 +94,12 @@ func BuildDesktopCommands(metaData hianime.SeriesData, episodeData hianime.Episo
 		args = append(args, fmt.Sprintf("--sub-delay=%.1f", historyData.SubDelay))
 	}
 
+	// Volume history command
+	if historyData.Volume > 0 {
+		fmt.Println("--> Adding volume from history...")
+		args = append(args, fmt.Sprintf("--volume=%d", historyData.Volume))
+	}
+
 	// track script & debug command
 	scriptLua, err := EnsureTrackScript("track.lua")
 	if err == nil {
@@ -108,6 +113,14 @@ func BuildDesktopCommands(metaData hianime.SeriesData, episodeData hianime.Episo
 	return args
 }
 
+// streamOrigin is the Origin the embed host of a stream expects, megacloud's when unknown.
+func streamOrigin(streamingData hianime.StreamData) string {
+	if streamingData.Origin == "" {
+		return "https://megacloud.blog"
+	}
+	return strings.TrimRight(streamingData.Origin, "/")
+}
+
 // NOTE: For intro and outro in mpv so user can know the timestamps and skip easily.
 func CreateChapters(data hianime.StreamData, historyData state.History, episodeData hianime.Episodes) string {
 
@@ -156,11 +169,14 @@ func CreateChapters(data hianime.StreamData, historyData state.History, episodeD
 }
 
 // Now it supports windows and linux automatically, without hardcoding the mpv path. I hope
-func PlayMpv(cmdMain string, args []string) (bool, float64, float64, float64) {
+// The last values are the volume it was left at, 0 when not reported, and how long mpv took to show the first frame.
+func PlayMpv(cmdMain string, args []string) (bool, float64, float64, float64, int, time.Duration) {
 	cmdName := cmdMain
 
 	var streamStarted bool
+	var firstFrame time.Duration
 	var subDelay float64
+	var volume int
 	var lastPos float64
 	var totalDuration float64
 
@@ -172,6 +188,7 @@ func PlayMpv(cmdMain string, args []string) (bool, float64, float64, float64) {
 	}
 
 	fmt.Println("\n--> Executing mpv commands...")
+	launchedAt := time.Now()
 
 	if err := cmd.Start(); err != nil {
 		fmt.Println("Error while running mpv: " + err.Error())
@@ -194,6 +211,7 @@ func PlayMpv(cmdMain string, args []string) (bool, float64, float64, float64) {
 			timer.Stop()
 			if !flag {
 				fmt.Println("\nStream is valid. Opening mpv")
+				firstFrame = time.Since(launchedAt)
 				flag = true
 			}
 
@@ -239,6 +257,17 @@ func PlayMpv(cmdMain string, args []string) (bool, float64, float64, float64) {
 
 			subDelay = floatDelay
 
+			continue
+		} else if strings.Contains(line, "::VOLUME::") {
+			parts := strings.Split(line, "::VOLUME::")
+
+			intVolume, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+			if err != nil {
+				fmt.Printf("Error while converting to int: %v\n", err)
+			}
+
+			volume = intVolume
+
 			continue
 		}
 	}
@@ -246,7 +275,7 @@ func PlayMpv(cmdMain string, args []string) (bool, float64, float64, float64) {
 	if err := cmd.Wait(); err != nil {
 	}
 
-	return streamStarted, subDelay, lastPos, totalDuration
+	return streamStarted, subDelay, lastPos, totalDuration, volume, firstFrame
 }
 
 func GetMpvBinary(configPath string) string {
@@ -277,16 +306,17 @@ func isWSL() bool {
 }
 
 func EnsureTrackScript(pathFile string) (string, error) {
-	dir := "scripts"
-	if err := os.MkdirAll(dir, 0755); err != nil {
-		return "", fmt.Errorf("Failed to create series directory: %w", err)
+	dir, err := paths.Scripts()
+	if err != nil {
+		return "", err
 	}
 
 	scriptPath := filepath.Join(dir, pathFile)
-	if _, err := os.Stat(scriptPath); err == nil {
+	if current, err := os.ReadFile(scriptPath); err == nil && string(current) == TrackScript {
 		fmt.Println("--> Lua script exist")
 
-	} else if os.IsNotExist(err) {
+	} else if err == nil || os.IsNotExist(err) {
+		// Missing, or written by an older version.
 
 		errA := os.WriteFile(scriptPath, []byte(TrackScript), 0644)
 		if errA != nil {
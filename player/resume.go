@@ -0,0 +1,46 @@
+package player
+
+import (
+	"hianime-mpv-go/config"
+	"hianime-mpv-go/hianime"
+	"hianime-mpv-go/state"
+)
+
+// Resume modes: where an episode left halfway starts again.
+const (
+	ResumeAsk      = "ask"    // ask in the menus every time
+	ResumeContinue = "resume" // from the saved position
+	ResumeRestart  = "start"  // from the beginning
+	ResumeIntro    = "intro"  // right after the intro, or the beginning when the stream has no intro
+)
+
+var ResumeModes = []string{ResumeAsk, ResumeContinue, ResumeRestart, ResumeIntro}
+
+// ResumeMode returns the configured mode. When it isn't set the menus ask, unless servers are picked
+// automatically, then playback resumes without a question.
+func ResumeMode(configData config.Settings) string {
+	switch configData.Resume {
+	case ResumeAsk, ResumeContinue, ResumeRestart, ResumeIntro:
+		return configData.Resume
+	}
+	if configData.AutoSelectServer {
+		return ResumeContinue
+	}
+	return ResumeAsk
+}
+
+// StartPosition returns the second mpv starts the episode at. Only episodes left halfway are resumed,
+// watched ones start over. Asking is up to the menus, here it resumes.
+func StartPosition(mode string, prog state.EpisodeProgress, intro hianime.Timestamp) float64 {
+	if !prog.Partial() {
+		return 0
+	}
+
+	switch mode {
+	case ResumeRestart:
+		return 0
+	case ResumeIntro:
+		return float64(intro.End)
+	}
+	return prog.Position
+}
@@ -0,0 +1,57 @@
+package player
+
+import (
+	"slices"
+	"sort"
+	"time"
+
+	"hianime-mpv-go/config"
+	"hianime-mpv-go/hianime"
+	"hianime-mpv-go/state"
+	"hianime-mpv-go/ui"
+)
+
+// SortServers orders servers by the position of their type in audio, types that aren't listed last.
+// Servers of the same type go from the best score to the worst, see state.ServerStats.Score. Servers never
+// tried score 0.5, and ties keep the order of the page.
+func SortServers(servers []hianime.ServerList, audio []string, scores map[string]float64) []hianime.ServerList {
+	score := func(server hianime.ServerList) float64 {
+		if s, ok := scores[state.ServerKey(server.Name)]; ok {
+			return s
+		}
+		return 0.5
+	}
+
+	sorted := slices.Clone(servers)
+	sort.SliceStable(sorted, func(a, b int) bool {
+		if ra, rb := rank(audio, sorted[a].Type), rank(audio, sorted[b].Type); ra != rb {
+			return ra < rb
+		}
+		return score(sorted[a]) > score(sorted[b])
+	})
+	return sorted
+}
+
+// OrderServers sorts servers for a series: its preferred audio types first, then the servers that worked best.
+func OrderServers(servers []hianime.ServerList, configData config.Settings, historyData state.History) []hianime.ServerList {
+	audio, _ := Preferences(configData, historyData)
+
+	stats, err := state.LoadServerStats()
+	if err != nil {
+		ui.DebugPrint("[SERVERS]", "Failed to load the server statistics: "+err.Error())
+	}
+	now := time.Now()
+	scores := make(map[string]float64, len(stats))
+	for name, s := range stats {
+		scores[name] = s.Score(now)
+	}
+
+	return SortServers(servers, audio, scores)
+}
+
+func rank(preferences []string, value string) int {
+	if i := slices.Index(preferences, value); i >= 0 {
+		return i
+	}
+	return len(preferences)
+}
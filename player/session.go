@@ -0,0 +1,105 @@
+package player
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"hianime-mpv-go/config"
+	"hianime-mpv-go/hianime"
+	"hianime-mpv-go/state"
+	"hianime-mpv-go/ui"
+)
+
+// Result holds what mpv reported back once a stream has been played.
+type Result struct {
+	Server     hianime.ServerList
+	SubDelay   float64
+	Volume     int // 0 when mpv didn't report it
+	Position   float64
+	Duration   float64
+	OutroStart float64 // start of the ending credits, 0 when the stream doesn't say
+	Start      float64 // position playback started at
+	StartedAt  time.Time
+	EndedAt    time.Time
+}
+
+// PlayServers tries the servers in order until one of them resolves to a stream that mpv can open.
+// It is the non-interactive counterpart of the manual server picker.
+func PlayServers(servers []hianime.ServerList, metaData hianime.SeriesData, episodeData hianime.Episodes, historyData state.History, configData config.Settings) (Result, error) {
+	if len(servers) == 0 {
+		return Result{}, fmt.Errorf("No available servers found.")
+	}
+
+	for _, server := range servers {
+		fmt.Printf("--> Selecting '%s'....\n", server.Name)
+
+		streamData, err := Resolve(server)
+		if err != nil {
+			continue
+		}
+
+		result, ok := PlayStream(server, streamData, metaData, episodeData, historyData, configData)
+		if ok {
+			return result, nil
+		}
+	}
+
+	return Result{}, fmt.Errorf("No available servers found for following episode.")
+}
+
+// Resolve fetches the stream of a server and records in the server statistics whether it worked.
+func Resolve(server hianime.ServerList) (hianime.StreamData, error) {
+	streamData, err := hianime.GetStreamData(server.DataId)
+	if err == nil && streamData.Url == "" {
+		err = fmt.Errorf("No stream url for server '%s'", server.Name)
+	}
+	if recordErr := state.RecordServerAttempt(server.Name, state.StageResolve, err == nil, 0); recordErr != nil {
+		ui.DebugPrint("[SERVERS]", "Failed to record the server attempt: "+recordErr.Error())
+	}
+	return streamData, err
+}
+
+// PlayStream plays an already resolved stream and reports whether mpv managed to start it.
+func PlayStream(server hianime.ServerList, streamData hianime.StreamData, metaData hianime.SeriesData, episodeData hianime.Episodes, historyData state.History, configData config.Settings) (Result, bool) {
+	// get mpv path automatically according user platforms.
+	binName := GetMpvBinary(configData.MpvPath)
+	desktopCommands := BuildDesktopCommands(metaData, episodeData, server, streamData, historyData, configData)
+	start := StartPosition(ResumeMode(configData), historyData.Episode[episodeData.Number], streamData.Intro)
+
+	startedAt := time.Now()
+	success, subDelay, lastPos, totalDur, volume, firstFrame := PlayMpv(binName, desktopCommands)
+	if err := state.RecordServerAttempt(server.Name, state.StageStart, success, firstFrame); err != nil {
+		ui.DebugPrint("[SERVERS]", "Failed to record the server attempt: "+err.Error())
+	}
+
+	return Result{
+		Server:     server,
+		SubDelay:   math.Round(subDelay*10) / 10,
+		Volume:     volume,
+		Position:   lastPos,
+		Duration:   totalDur,
+		OutroStart: float64(streamData.Outro.Start),
+		Start:      start,
+		StartedAt:  startedAt,
+		EndedAt:    time.Now(),
+	}, success
+}
+
+// Session turns the result into a viewing record. history must already hold the progress of the result.
+func (r Result) Session(history state.History, episodeNum int) state.SessionRecord {
+	// Seeking forward doesn't count, so the time played is at most the time mpv was open.
+	seconds := max(0, r.Position-r.Start)
+	seconds = min(seconds, r.EndedAt.Sub(r.StartedAt).Seconds())
+
+	prog := history.Episode[episodeNum]
+	return state.SessionRecord{
+		SeriesKey: history.Key(),
+		Series:    history.JapaneseName,
+		Episode:   episodeNum,
+		StartedAt: r.StartedAt,
+		EndedAt:   r.EndedAt,
+		Seconds:   seconds,
+		Finished:  prog.Watched && !prog.LastWatchedAt.Before(r.StartedAt),
+	}
+}
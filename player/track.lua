@@ -21,3 +21,10 @@ mp.add_periodic_timer(1, function()
 		end
 	end)
 end)
+
+mp.observe_property("volume", "number", function(name, value)
+	if value then
+		-- Format: ::VOLUME::80
+		print(string.format("::VOLUME::%d", math.floor(value + 0.5)))
+	end
+end)
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"hianime-mpv-go/config"
+	"hianime-mpv-go/paths"
+	"hianime-mpv-go/state"
+)
+
+const profileUsage = `Usage:
+  profile [list]          List the profiles, the one in use marked with *
+  profile add <name>      Create a profile with its own history, watchlist and AniList login
+  profile remove <name>   Remove a profile from the config, its history stays on disk
+
+Pick a profile with --profile NAME or HIANIME_PROFILE, the menus ask when profiles exist.
+Settings a profile overrides go in "profiles" in the config, e.g. {"alice": {"english_only": false}}.`
+
+func cmdProfile(args []string, history []state.History, configSession config.Settings) error {
+	action := "list"
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		action, args = args[0], args[1:]
+	}
+	if action == "help" {
+		fmt.Println(profileUsage)
+		return nil
+	}
+
+	positional, err := parseInterleaved(newFlagSet("profile"), args)
+	if err != nil {
+		return errUsage
+	}
+
+	switch action {
+	case "list":
+		if len(positional) != 0 {
+			break
+		}
+		current := paths.Profile
+		if current == "" {
+			current = config.DefaultProfile
+		}
+		for _, name := range append([]string{config.DefaultProfile}, configSession.ProfileNames()...) {
+			marker := " "
+			if name == current {
+				marker = "*"
+			}
+			fmt.Printf("%s %s\n", marker, name)
+		}
+		return nil
+
+	case "add", "remove":
+		if len(positional) != 1 {
+			break
+		}
+		name := positional[0]
+		if err := config.ValidProfileName(name); err != nil {
+			return err
+		}
+
+		// Reloaded so the overrides of the profile in use don't end up in the shared settings.
+		saved, err := config.LoadConfig()
+		if err != nil {
+			return err
+		}
+		_, exists := saved.Profiles[name]
+
+		if action == "add" {
+			if exists {
+				return fmt.Errorf("Profile '%s' already exists", name)
+			}
+			// The AniList login isn't shared, every profile logs in to its own account.
+			if err := saved.SetProfileValue(name, "anilist", map[string]string{"token": ""}); err != nil {
+				return err
+			}
+			if err := config.SaveConfig(saved); err != nil {
+				return err
+			}
+			fmt.Printf("--> Added profile '%s'. Use it with --profile %s\n", name, name)
+			return nil
+		}
+
+		if !exists {
+			return fmt.Errorf("Unknown profile '%s'", name)
+		}
+		delete(saved.Profiles, name)
+		if err := config.SaveConfig(saved); err != nil {
+			return err
+		}
+		fmt.Printf("--> Removed profile '%s'. Its history is still in the profiles directory of the data directory.\n", name)
+		return nil
+	}
+
+	fmt.Fprintln(os.Stderr, profileUsage)
+	return errUsage
+}
+
+// pickProfile asks which profile to use before the menus start. Enter picks the default profile.
+func pickProfile(configSession config.Settings) string {
+	names := append([]string{config.DefaultProfile}, configSession.ProfileNames()...)
+
+	fmt.Println("--- Profiles ---")
+	for i, name := range names {
+		fmt.Printf(" [%d] %s\n", i+1, name)
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	for {
+		fmt.Print("\nWho's watching? (enter for default): ")
+		if !scanner.Scan() {
+			return config.DefaultProfile
+		}
+
+		input := strings.TrimSpace(scanner.Text())
+		if input == "" {
+			return config.DefaultProfile
+		}
+		if num, err := strconv.Atoi(input); err == nil && num >= 1 && num <= len(names) {
+			return names[num-1]
+		}
+		for _, name := range names {
+			if strings.EqualFold(name, input) {
+				return name
+			}
+		}
+		fmt.Println("Number is invalid.")
+	}
+}
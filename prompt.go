@@ -0,0 +1,414 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"hianime-mpv-go/anilist"
+	"hianime-mpv-go/config"
+	"hianime-mpv-go/hianime"
+	"hianime-mpv-go/player"
+	"hianime-mpv-go/selector"
+	"hianime-mpv-go/state"
+	"hianime-mpv-go/ui"
+)
+
+var cacheEpisodes = make(map[string][]hianime.Episodes) // "AnimeID" : {{Eps: 1, ...}, ...}
+
+// saveSeries stores the series and returns the refreshed library. If saving fails the change is only kept in memory.
+func saveSeries(history []state.History, historySelect state.History) []state.History {
+	updated, err := state.SaveSeries(historySelect)
+	if err != nil {
+		fmt.Println("Failed to save history: " + err.Error())
+		return state.UpdateHistory(history, historySelect)
+	}
+	return updated
+}
+
+func addToWatchlist(series hianime.SearchElements) {
+	_, err := state.UpdateWatchlist(func(list []state.WatchlistEntry) ([]state.WatchlistEntry, error) {
+		return state.AddToWatchlist(list, series.SeriesData())
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("--> %s added to the watchlist\n", series.JapaneseName)
+}
+
+// runPrompt is the line based menu, used with -plain or when stdout isn't a terminal.
+// askResume offers to resume an episode left halfway, start it over or start it after the intro.
+// Episodes that weren't left halfway aren't asked about.
+func askResume(scanner *bufio.Scanner, prog state.EpisodeProgress, intro hianime.Timestamp) string {
+	if !prog.Partial() {
+		return player.ResumeContinue
+	}
+
+	fmt.Printf("\n [1] Resume from %s\n [2] Start over\n", ui.PrettyDuration(prog.Position))
+	if intro.End > 0 {
+		fmt.Printf(" [3] Start after the intro (%s)\n", ui.PrettyDuration(float64(intro.End)))
+	}
+
+	for {
+		fmt.Print("\nChoose how to start (enter to resume): ")
+		scanner.Scan()
+
+		switch strings.TrimSpace(scanner.Text()) {
+		case "", "1":
+			return player.ResumeContinue
+		case "2":
+			return player.ResumeRestart
+		case "3":
+			if intro.End > 0 {
+				return player.ResumeIntro
+			}
+		}
+		fmt.Println("Number is invalid.")
+	}
+}
+
+func runPrompt(history []state.History, configSession config.Settings) {
+	scanner := bufio.NewScanner(os.Stdin)
+	sel := selector.Selector{Mode: configSession.Selector, Scanner: scanner}
+
+	var url string
+series_loop:
+	for {
+		recent := state.Recent(history, state.RecentLimit)
+		if len(recent) > 0 {
+			fmt.Printf("\n--- Recent History ---\n\n")
+			for i := range recent {
+				fmt.Printf(" [%d] %s\n", i+1, recent[i].JapaneseName)
+			}
+
+		} else {
+			fmt.Printf("\n--- No recent history found ---\n\n")
+		}
+
+		watchlist, err := state.LoadWatchlist()
+		if err != nil {
+			fmt.Println("Failed to load the watchlist: " + err.Error())
+		}
+		if len(watchlist) > 0 {
+			fmt.Printf("\n--- Watchlist ---\n\n")
+			for i := range watchlist {
+				if i == state.RecentLimit {
+					fmt.Printf(" ... %d more, see 'watchlist list'\n", len(watchlist)-i)
+					break
+				}
+				fmt.Printf(" [w%d] %s\n", i+1, watchlist[i].JapaneseName)
+			}
+		}
+
+		if sel.Enabled() {
+			fmt.Print("\nEnter number, 'w' + number for the watchlist, 'f' to find in library or paste hianime url to play (or 's' to call api search): ")
+		} else {
+			fmt.Print("\nEnter number, 'w' + number for the watchlist or paste hianime url to play (or 's' to call api search): ")
+		}
+		scanner.Scan()
+
+		seriesInput := strings.TrimSpace(scanner.Text())
+
+		var picked *state.History
+		if ref, ok := strings.CutPrefix(seriesInput, "w"); ok && ref != "" {
+			// Opening a watchlist entry promotes it to the library.
+			promoted, library, err := state.PromoteFromWatchlist(strings.TrimSpace(ref))
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			history = library
+			picked = &promoted
+		}
+		if sel.Enabled() && seriesInput == "f" {
+			found, ok, err := selector.Select(sel, "Library", ui.HistoryChoices(state.FilterLibrary(history, state.LibraryFilter{})))
+			if err != nil {
+				fmt.Println(err)
+			}
+			if !ok {
+				continue
+			}
+			picked = &found
+		}
+
+		if seriesInput == "q" {
+			break series_loop
+		} else if seriesInput == "s" {
+			var searchData []hianime.SearchElements
+			var err error
+			for {
+				fmt.Printf("\nEnter anime name to search (or 'q' to go back):")
+				scanner.Scan()
+				searchInput := scanner.Text()
+				searchData, err = hianime.Search(searchInput)
+				if err != nil {
+					fmt.Println(err)
+				}
+
+				if len(searchData) != 0 {
+					ui.PrintSeries(searchData)
+					break
+				} else {
+					fmt.Println("--! No anime result found")
+					continue
+				}
+			}
+
+			if sel.Enabled() {
+				found, ok, err := selector.Select(sel, "Search", ui.SeriesChoices(searchData))
+				if err != nil {
+					fmt.Println(err)
+				}
+				if !ok {
+					continue
+				}
+
+				fmt.Printf("\nPress enter to play %s (or 'w' to add it to the watchlist): ", found.JapaneseName)
+				scanner.Scan()
+				if strings.TrimSpace(scanner.Text()) == "w" {
+					addToWatchlist(found)
+					continue
+				}
+				seriesInput = found.Url
+			}
+
+			for !sel.Enabled() {
+				fmt.Printf("\nEnter anime number to play (or 'w' + number to add it to the watchlist): ")
+				scanner.Scan()
+
+				usrInput := strings.TrimSpace(scanner.Text())
+				ref, toWatchlist := strings.CutPrefix(usrInput, "w")
+				usrInputInt, err := strconv.Atoi(strings.TrimSpace(ref))
+				if err != nil {
+					fmt.Println("Failed to convert to integer. Input number.")
+					continue
+				}
+				if usrInputInt < 1 || usrInputInt > len(searchData) {
+					fmt.Println("Number is invalid.")
+					continue
+				}
+
+				if toWatchlist {
+					addToWatchlist(searchData[usrInputInt-1])
+					continue series_loop
+				}
+				seriesInput = searchData[usrInputInt-1].Url
+				fmt.Println(url)
+				break
+			}
+		}
+
+		var historySelect state.History
+		var seriesMetadata hianime.SeriesData
+
+		if strings.Contains(seriesInput, "hianime.to") {
+			url = seriesInput
+			seriesMetadata = hianime.GetSeriesData(url)
+
+			// Series already in the library keep their progress.
+			found, exists := state.FindHistory(history, seriesMetadata)
+			if exists {
+				historySelect = found
+			} else {
+				historySelect = state.NewHistory(seriesMetadata)
+			}
+
+			history = saveSeries(history, historySelect)
+		} else {
+			if seriesInput == "q" {
+				continue
+			}
+
+			if picked != nil {
+				historySelect = *picked
+			} else {
+				seriesInputInt, err := strconv.Atoi(seriesInput)
+				if err != nil {
+					fmt.Println("Failed to convert to integer. Input number or paste url")
+					continue
+				}
+				if seriesInputInt < 1 || seriesInputInt > len(recent) {
+					fmt.Println("Number is invalid.")
+					continue
+				}
+
+				historySelect = recent[seriesInputInt-1]
+			}
+			url = historySelect.Url
+
+			seriesMetadata = hianime.GetSeriesData(url)
+			historySelect.FillIDs(seriesMetadata)
+
+			history = saveSeries(history, historySelect)
+		}
+
+	episode_loop:
+		for {
+			fmt.Printf("\n--- Series: %s ---\n\n", seriesMetadata.JapaneseName)
+
+			episodeCache, exists := cacheEpisodes[seriesMetadata.AnimeID]
+			if !exists {
+				episodeCache = hianime.GetEpisodes(seriesMetadata.AnimeID)
+				cacheEpisodes[seriesMetadata.AnimeID] = episodeCache
+				if err := state.DefaultStore.SaveEpisodes(seriesMetadata.AnimeID, episodeCache); err != nil {
+					fmt.Println("Failed to store episode list: " + err.Error())
+				}
+			}
+
+			ui.PrintEpisodes(episodeCache, historySelect)
+
+			if sel.Enabled() {
+				fmt.Print("\nEnter episode (" + selectionHelp + "), 'f' to find (or 'q' to go back): ")
+			} else {
+				fmt.Print("\nEnter episode (" + selectionHelp + ") (or 'q' to go back): ")
+			}
+			scanner.Scan()
+
+			episodeInput := scanner.Text()
+			episodeInput = strings.TrimSpace(episodeInput)
+
+			if episodeInput == "q" {
+				break episode_loop
+			}
+
+			var queue []int
+			if sel.Enabled() && episodeInput == "f" {
+				found, ok, err := selector.Select(sel, "Episodes", ui.EpisodeChoices(episodeCache, historySelect))
+				if err != nil {
+					fmt.Println(err)
+				}
+				if !ok {
+					continue
+				}
+				queue = []int{found.Number}
+			} else {
+				selection, err := parseEpisodeSelection(episodeInput, episodeCache, historySelect)
+				if err != nil {
+					fmt.Println(err)
+					continue
+				}
+				queue = selection
+			}
+
+		queue_loop:
+			for queueIndex, selectedNum := range queue {
+				selectedEpisode := episodeCache[selectedNum-1]
+				servers := player.OrderServers(hianime.GetEpisodeServerId(selectedEpisode.Id), configSession, historySelect)
+
+				historySelect.LastEpisode = selectedNum
+
+				history = saveSeries(history, historySelect)
+
+				if len(queue) > 1 {
+					fmt.Printf("\n--> Queue: episode %d (%d/%d)\n", selectedNum, queueIndex+1, len(queue))
+				}
+
+				var testedServer int
+				playConfig := configSession
+			server_loop:
+				for {
+					if len(servers) == 0 {
+						fmt.Println("\nNo available servers found.")
+						break
+					}
+
+					var selectedServer hianime.ServerList
+					var streamData hianime.StreamData
+
+					if configSession.AutoSelectServer {
+						if testedServer >= len(servers) {
+							fmt.Println("\nNo available servers found for following episode.")
+							break
+						}
+
+						fmt.Println("\n--> Auto-select server enabled.")
+
+						for i := testedServer; i < len(servers); i++ {
+							selectedServer = servers[i]
+
+							fmt.Printf("--> Selecting '%s'....\n", selectedServer.Name)
+
+							attempt, err := player.Resolve(selectedServer)
+							if err == nil {
+								streamData = attempt
+								testedServer = i + 1
+								break
+							}
+						}
+
+					} else {
+						fmt.Print("\n--- Available Servers ---\n")
+
+						ui.PrintServers(servers)
+						fmt.Print("\nEnter server number (or 'q' to go back): ")
+						scanner.Scan()
+
+						serverInput := scanner.Text()
+						serverInput = strings.TrimSpace(serverInput)
+
+						if serverInput == "q" {
+							break queue_loop
+						}
+						serverInputInt, err := strconv.Atoi(serverInput)
+						if err != nil {
+							fmt.Printf("Error when converting to int: %s\n", err.Error())
+							continue
+						}
+
+						if serverInputInt > 0 && serverInputInt <= len(servers) {
+							selectedServer = servers[serverInputInt-1]
+							// Picked by hand, so the series tries this type first next time.
+							historySelect.AudioType = selectedServer.Type
+
+							attempt, err := player.Resolve(selectedServer)
+							if err == nil {
+								streamData = attempt
+								fmt.Println(streamData)
+							}
+						} else {
+							fmt.Println("Number is invalid.")
+							continue
+						}
+					}
+
+					if streamData.Url == "" {
+						fmt.Println("Couldn't find streamdata url!")
+						continue
+					}
+
+					// Asked once per episode, the answer holds when another server is tried.
+					if player.ResumeMode(playConfig) == player.ResumeAsk {
+						playConfig.Resume = askResume(scanner, historySelect.Episode[selectedNum], streamData.Intro)
+					}
+
+					result, success := player.PlayStream(selectedServer, streamData, seriesMetadata, selectedEpisode, historySelect, playConfig)
+
+					if success {
+						historySelect.RecordProgress(selectedEpisode.Number, result.Position, result.Duration, result.OutroStart, result.SubDelay, result.Volume)
+
+						history = saveSeries(history, historySelect)
+						if err := state.AddSession(result.Session(historySelect, selectedEpisode.Number)); err != nil {
+							fmt.Println("--! Failed to record the viewing session: " + err.Error())
+						}
+						if err := anilist.Track(historySelect, selectedEpisode.Number); err != nil {
+							fmt.Println("--! AniList sync failed: " + err.Error())
+						}
+
+						// Closing mpv before the end means the user wants to stop, so don't start the next queued episode.
+						if !historySelect.Episode[selectedEpisode.Number].Finished() && queueIndex < len(queue)-1 {
+							fmt.Println("\n--> Episode wasn't finished. Stopping the queue.")
+							break queue_loop
+						}
+
+						break server_loop
+					} else {
+						continue
+					}
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package safefile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// lockTimeout is how long to wait for another session before giving up.
+const lockTimeout = 10 * time.Second
+
+// WithLock runs fn while holding path.lock, an exclusive lock shared by every session.
+// The lock isn't reentrant: fn must not call WithLock on the same path again.
+func WithLock(path string, fn func() error) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("Failed to find/create directory: %w", err)
+	}
+
+	f, err := os.OpenFile(path+".lock", os.O_CREATE|os.O_RDWR, Perm)
+	if err != nil {
+		return fmt.Errorf("Failed to open lock file: %w", err)
+	}
+	defer f.Close()
+
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		err := tryLock(f)
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Timed out waiting for another session to release %s: %w", filepath.Base(path), err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	defer unlock(f)
+
+	return fn()
+}
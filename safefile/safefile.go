@@ -0,0 +1,126 @@
+// Package safefile reads and writes the small json files of this program without losing them:
+// writes go through a temp file and a rename, the previous good copy is kept as a backup,
+// a lock file serializes sessions, and documents carry a schema_version that is upgraded on load.
+package safefile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Perm is used for every file written here. Nothing written here is executable.
+const Perm os.FileMode = 0644
+
+func backupPath(path string) string {
+	return path + ".bak"
+}
+
+// Write replaces path with data atomically: a crash leaves either the old or the new file, never half of one.
+// The previous contents are kept in path.bak first. Callers sharing the file between sessions should hold WithLock.
+func Write(path string, data []byte) error {
+	if old, err := os.ReadFile(path); err == nil && len(old) > 0 {
+		if err := writeAtomic(backupPath(path), old); err != nil {
+			return fmt.Errorf("Failed to back up %s: %w", filepath.Base(path), err)
+		}
+	}
+
+	return writeAtomic(path, data)
+}
+
+func writeAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("Failed to find/create directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("Failed to create temporary file: %w", err)
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName) // no-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("Failed to write temporary file: %w", err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("Failed to sync temporary file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("Failed to close temporary file: %w", err)
+	}
+	if err := os.Chmod(tmpName, Perm); err != nil {
+		return fmt.Errorf("Failed to set permissions: %w", err)
+	}
+
+	if err := os.Rename(tmpName, path); err != nil {
+		return fmt.Errorf("Failed to replace %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// Load reads path, upgrades it to schema.Current and hands it to decode. It reports false when the file doesn't exist.
+//
+// When the file can't be upgraded or decoded it is renamed to path.corrupt-<time> and the backup is tried instead.
+// A file from a newer version of the program is an error instead, so it isn't thrown away.
+// If the backup is unusable too, Load reports false so the caller starts from its defaults.
+// An upgraded or recovered document is written back, so the next load is a plain read.
+func Load(path string, schema Schema, decode func([]byte) error) (bool, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("Failed to open %s: %w", filepath.Base(path), err)
+	}
+	// Older versions created the file empty before writing it, treat that as missing rather than corrupt.
+	if len(bytes.TrimSpace(data)) == 0 {
+		return false, nil
+	}
+
+	upgraded, changed, err := decodeUpgraded(data, schema, decode)
+	if err == nil {
+		if changed {
+			return true, Write(path, upgraded)
+		}
+		return true, nil
+	}
+	if errors.Is(err, ErrNewerSchema) {
+		return false, fmt.Errorf("Failed to load %s: %w", filepath.Base(path), err)
+	}
+
+	corruptPath := fmt.Sprintf("%s.corrupt-%s", path, time.Now().Format("20060102-150405"))
+	if err := os.Rename(path, corruptPath); err != nil {
+		return false, fmt.Errorf("Failed to move corrupt %s aside: %w", filepath.Base(path), err)
+	}
+	fmt.Printf("--! %s is corrupt (%v). Moved it to %s.\n", filepath.Base(path), err, filepath.Base(corruptPath))
+
+	backup, readErr := os.ReadFile(backupPath(path))
+	if readErr != nil {
+		return false, nil
+	}
+	upgraded, _, err = decodeUpgraded(backup, schema, decode)
+	if err != nil {
+		fmt.Printf("--! Backup %s is unusable too, starting fresh.\n", filepath.Base(backupPath(path)))
+		return false, nil
+	}
+
+	fmt.Printf("--> Restored %s from its backup.\n", filepath.Base(path))
+	return true, writeAtomic(path, upgraded)
+}
+
+func decodeUpgraded(data []byte, schema Schema, decode func([]byte) error) ([]byte, bool, error) {
+	upgraded, changed, err := schema.Upgrade(data)
+	if err != nil {
+		return nil, false, err
+	}
+	if err := decode(upgraded); err != nil {
+		return nil, false, err
+	}
+	return upgraded, changed, nil
+}
@@ -0,0 +1,87 @@
+package safefile
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// ErrNewerSchema means the file was written by a newer version of this program. It is left untouched.
+var ErrNewerSchema = errors.New("schema_version is newer than this program supports")
+
+// Migration upgrades a document by one version. It must return the document with schema_version set to the new version.
+type Migration func(data []byte) ([]byte, error)
+
+// Schema describes the versions of one kind of file. Migrations[v] upgrades a version v document to v+1.
+// The zero Schema means the file isn't versioned, and only has to be valid json.
+type Schema struct {
+	Current    int
+	Migrations map[int]Migration
+}
+
+// Version returns the schema_version of a document. Documents written before versioning existed are version 1,
+// both bare json arrays and objects without the field.
+func Version(data []byte) (int, error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 {
+		return 0, fmt.Errorf("file is empty")
+	}
+	if !json.Valid(trimmed) {
+		return 0, fmt.Errorf("file isn't valid json")
+	}
+
+	if trimmed[0] != '{' {
+		return 1, nil
+	}
+
+	var header struct {
+		SchemaVersion *int `json:"schema_version"`
+	}
+	if err := json.Unmarshal(trimmed, &header); err != nil {
+		return 0, err
+	}
+	if header.SchemaVersion == nil {
+		return 1, nil
+	}
+	return *header.SchemaVersion, nil
+}
+
+// Upgrade runs the migrations needed to bring data to s.Current and reports whether anything ran.
+func (s Schema) Upgrade(data []byte) ([]byte, bool, error) {
+	version, err := Version(data)
+	if err != nil {
+		return nil, false, err
+	}
+	if s.Current == 0 {
+		return data, false, nil
+	}
+	if version > s.Current {
+		return nil, false, fmt.Errorf("%w (%d > %d)", ErrNewerSchema, version, s.Current)
+	}
+
+	changed := false
+	for ; version < s.Current; version++ {
+		migrate, ok := s.Migrations[version]
+		if !ok {
+			return nil, false, fmt.Errorf("no migration from schema_version %d", version)
+		}
+		if data, err = migrate(data); err != nil {
+			return nil, false, fmt.Errorf("migration from schema_version %d failed: %w", version, err)
+		}
+		changed = true
+	}
+
+	return data, changed, nil
+}
+
+// SetVersion is a helper for migrations of json objects that only need the version bumped.
+func SetVersion(data []byte, version int) ([]byte, error) {
+	doc := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	doc["schema_version"] = json.RawMessage(fmt.Sprintf("%d", version))
+	return json.MarshalIndent(doc, "", " ")
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"hianime-mpv-go/hianime"
+	"hianime-mpv-go/state"
+)
+
+const selectionHelp = "number, 'n'ext, 'p'rev, 'last', 'latest', range like 3-7 or /keyword"
+
+// parseEpisodeSelection turns the episode prompt input into the episode numbers to play, in order.
+// Empty input means the last watched episode, like before.
+func parseEpisodeSelection(input string, episodes []hianime.Episodes, history state.History) ([]int, error) {
+	input = strings.TrimSpace(input)
+	total := len(episodes)
+	if total == 0 {
+		return nil, fmt.Errorf("No episodes to select from.")
+	}
+
+	inRange := func(num int) ([]int, error) {
+		if num < 1 || num > total {
+			return nil, fmt.Errorf("Episode %d is out of range (1-%d)", num, total)
+		}
+		return []int{num}, nil
+	}
+
+	switch strings.ToLower(input) {
+	case "", "last":
+		return inRange(history.LastEpisode)
+	case "latest":
+		return inRange(total)
+	case "n", "next":
+		for _, eps := range episodes {
+			if !history.Episode[eps.Number].Finished() {
+				return []int{eps.Number}, nil
+			}
+		}
+		return nil, fmt.Errorf("Every episode is already watched.")
+	case "p", "prev":
+		return inRange(history.LastEpisode - 1)
+	}
+
+	if keyword, ok := strings.CutPrefix(input, "/"); ok {
+		return searchEpisodes(keyword, episodes)
+	}
+
+	if from, to, ok := strings.Cut(input, "-"); ok {
+		start, errStart := strconv.Atoi(strings.TrimSpace(from))
+		end, errEnd := strconv.Atoi(strings.TrimSpace(to))
+		if errStart != nil || errEnd != nil {
+			return nil, fmt.Errorf("Invalid range '%s', use e.g. 3-7", input)
+		}
+		if start > end || start < 1 || end > total {
+			return nil, fmt.Errorf("Range %d-%d is out of range (1-%d)", start, end, total)
+		}
+
+		var queue []int
+		for num := start; num <= end; num++ {
+			queue = append(queue, num)
+		}
+		return queue, nil
+	}
+
+	num, err := strconv.Atoi(input)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid selection '%s', use %s", input, selectionHelp)
+	}
+	return inRange(num)
+}
+
+// searchEpisodes looks for keyword in the English and Japanese titles. It only selects when exactly one episode matches.
+func searchEpisodes(keyword string, episodes []hianime.Episodes) ([]int, error) {
+	keyword = strings.ToLower(strings.TrimSpace(keyword))
+	if keyword == "" {
+		return nil, fmt.Errorf("Enter a keyword after '/'")
+	}
+
+	var matches []string
+	var found []int
+	for _, eps := range episodes {
+		if strings.Contains(strings.ToLower(eps.EnglishTitle), keyword) || strings.Contains(strings.ToLower(eps.JapaneseTitle), keyword) {
+			found = append(found, eps.Number)
+			matches = append(matches, fmt.Sprintf(" [%02d] %s", eps.Number, eps.EnglishTitle))
+		}
+	}
+
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("No episode title matches '%s'", keyword)
+	case 1:
+		return found, nil
+	}
+
+	return nil, fmt.Errorf("'%s' matches %d episodes, enter one number:\n%s", keyword, len(found), strings.Join(matches, "\n"))
+}
+
+// parseEpisodeNumbers reads a list of episode numbers and ranges like "3", "3-7" or "1,4,6-8".
+func parseEpisodeNumbers(input string) ([]int, error) {
+	var numbers []int
+	for _, part := range strings.Split(input, ",") {
+		part = strings.TrimSpace(part)
+		from, to, isRange := strings.Cut(part, "-")
+		if !isRange {
+			to = from
+		}
+
+		start, errStart := strconv.Atoi(strings.TrimSpace(from))
+		end, errEnd := strconv.Atoi(strings.TrimSpace(to))
+		if errStart != nil || errEnd != nil || start < 1 || start > end {
+			return nil, fmt.Errorf("Invalid episodes '%s', use e.g. 3, 3-7 or 1,4,6-8", input)
+		}
+		for num := start; num <= end; num++ {
+			numbers = append(numbers, num)
+		}
+	}
+	return numbers, nil
+}
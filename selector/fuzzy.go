@@ -0,0 +1,133 @@
+package selector
+
+import (
+	"bufio"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// maxShown caps how many matches the builtin matcher prints per round.
+const maxShown = 20
+
+// Score reports whether every rune of query appears in target in order, ignoring case.
+// Matches right after the previous one or at the start of a word score higher, so "opm" ranks "One Punch Man" first.
+func Score(query, target string) (int, bool) {
+	if query == "" {
+		return 0, true
+	}
+
+	q := []rune(strings.ToLower(query))
+	t := []rune(strings.ToLower(target))
+
+	score := 0
+	qi := 0
+	prev := -2
+	for ti := 0; ti < len(t) && qi < len(q); ti++ {
+		if unicode.IsSpace(q[qi]) {
+			qi++
+			ti--
+			continue
+		}
+		if t[ti] != q[qi] {
+			continue
+		}
+
+		score++
+		if ti == prev+1 {
+			score += 3
+		}
+		if ti == 0 || !unicode.IsLetter(t[ti-1]) && !unicode.IsDigit(t[ti-1]) {
+			score += 2
+		}
+
+		prev = ti
+		qi++
+	}
+
+	for qi < len(q) && unicode.IsSpace(q[qi]) {
+		qi++
+	}
+	if qi < len(q) {
+		return 0, false
+	}
+
+	return score, true
+}
+
+// Filter returns the indices of the labels matching query, best match first. Ties keep their original order.
+func Filter(query string, labels []string) []int {
+	type match struct {
+		index int
+		score int
+	}
+
+	var matches []match
+	for i, label := range labels {
+		if score, ok := Score(query, label); ok {
+			matches = append(matches, match{index: i, score: score})
+		}
+	}
+
+	sort.SliceStable(matches, func(a, b int) bool {
+		return matches[a].score > matches[b].score
+	})
+
+	indices := make([]int, len(matches))
+	for i := range matches {
+		indices[i] = matches[i].index
+	}
+	return indices
+}
+
+// runBuiltin is the line based fallback: type text to narrow the list, a number to pick, empty input to cancel.
+func runBuiltin[T any](scanner *bufio.Scanner, prompt string, items []Item[T]) (int, bool, error) {
+	labels := make([]string, len(items))
+	for i := range items {
+		labels[i] = items[i].Label
+	}
+
+	query := ""
+	for {
+		matches := Filter(query, labels)
+
+		fmt.Printf("\n--- %s", prompt)
+		if query != "" {
+			fmt.Printf(" matching '%s'", query)
+		}
+		fmt.Printf(" (%d/%d) ---\n\n", len(matches), len(items))
+
+		shown := matches
+		if len(shown) > maxShown {
+			shown = shown[:maxShown]
+		}
+		for i, index := range shown {
+			fmt.Printf(" [%d] %s\n", i+1, items[index].Label)
+			if items[index].Preview != "" {
+				fmt.Printf("      %s\n", items[index].Preview)
+			}
+		}
+
+		fmt.Print("\nType to filter, number to pick (or empty to cancel): ")
+		if !scanner.Scan() {
+			return 0, false, scanner.Err()
+		}
+
+		input := strings.TrimSpace(scanner.Text())
+		if input == "" {
+			return 0, false, nil
+		}
+
+		if num, err := strconv.Atoi(input); err == nil {
+			if num > 0 && num <= len(shown) {
+				return shown[num-1], true, nil
+			}
+			fmt.Println("Number is invalid.")
+			continue
+		}
+
+		query = input
+	}
+}
@@ -0,0 +1,121 @@
+package selector
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// Modes accepted by the "selector" config key and the -selector flag.
+const (
+	ModeOff     = ""
+	ModeAuto    = "auto"
+	ModeFzf     = "fzf"
+	ModeSkim    = "sk"
+	ModeBuiltin = "builtin"
+)
+
+// Item is one choice shown to the user. Value is what Select gives back, so callers never deal with indices.
+type Item[T any] struct {
+	Label   string
+	Preview string
+	Value   T
+}
+
+// Selector decides which finder is used. Scanner must be the same one the caller reads stdin with,
+// otherwise both would buffer input and steal lines from each other.
+type Selector struct {
+	Mode    string
+	Scanner *bufio.Scanner
+}
+
+func (s Selector) Enabled() bool {
+	return s.Mode != ModeOff
+}
+
+// finder returns the external binary to run, or "" when the builtin matcher should be used.
+func (s Selector) finder() string {
+	switch s.Mode {
+	case ModeFzf, ModeSkim:
+		if _, err := exec.LookPath(s.Mode); err == nil {
+			return s.Mode
+		}
+		fmt.Printf("--! '%s' not found in PATH, using builtin matcher.\n", s.Mode)
+	case ModeAuto:
+		for _, bin := range []string{ModeFzf, ModeSkim} {
+			if _, err := exec.LookPath(bin); err == nil {
+				return bin
+			}
+		}
+	}
+	return ""
+}
+
+// Select lets the user pick one of items. ok is false when the user cancelled.
+func Select[T any](s Selector, prompt string, items []Item[T]) (T, bool, error) {
+	var zero T
+	if len(items) == 0 {
+		return zero, false, nil
+	}
+
+	var index int
+	var ok bool
+	var err error
+
+	if bin := s.finder(); bin != "" {
+		index, ok, err = runExternal(bin, prompt, items)
+	} else {
+		index, ok, err = runBuiltin(s.Scanner, prompt, items)
+	}
+	if err != nil || !ok {
+		return zero, false, err
+	}
+
+	return items[index].Value, true, nil
+}
+
+func clean(text string) string {
+	return strings.NewReplacer("\t", " ", "\n", " ", "\r", "").Replace(text)
+}
+
+// runExternal pipes "index<TAB>label<TAB>preview" lines into fzf/skim. Only the label is shown and searched,
+// the preview column feeds the preview window, and the index maps the picked line back to the item.
+func runExternal[T any](bin string, prompt string, items []Item[T]) (int, bool, error) {
+	var input bytes.Buffer
+	for i, item := range items {
+		fmt.Fprintf(&input, "%d\t%s\t%s\n", i, clean(item.Label), clean(item.Preview))
+	}
+
+	cmd := exec.Command(bin,
+		"--delimiter=\t",
+		"--with-nth=2",
+		"--preview=echo {3}",
+		"--preview-window=down:3:wrap",
+		"--prompt="+prompt+"> ",
+	)
+	cmd.Stdin = &input
+	cmd.Stderr = os.Stderr
+
+	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		// 1 means no match and 130 means the user pressed esc/ctrl-c, both are a cancel.
+		if errors.As(err, &exitErr) && (exitErr.ExitCode() == 1 || exitErr.ExitCode() == 130) {
+			return 0, false, nil
+		}
+		return 0, false, fmt.Errorf("Failed to run %s: %w", bin, err)
+	}
+
+	rawIndex, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\t")
+	index, err := strconv.Atoi(rawIndex)
+	if err != nil || index < 0 || index >= len(items) {
+		return 0, false, fmt.Errorf("Unexpected selection from %s: %q", bin, output)
+	}
+
+	return index, true, nil
+}
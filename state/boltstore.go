@@ -0,0 +1,471 @@
+package state
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+
+	"hianime-mpv-go/hianime"
+)
+
+// BoltStore keeps the state in an embedded bbolt database, state/history.db.
+//
+// Layout:
+//
+//	series    key -> seriesRecord (the History without its episode map)
+//	progress  key -> bucket of episode number -> EpisodeProgress
+//	episodes  AnimeID -> []hianime.Episodes
+//	watchlist "entries" -> []WatchlistEntry, in order
+//	settings  name -> value
+//	downloads sequence -> DownloadRecord
+//	sessions  sequence -> SessionRecord
+//
+// The database is opened for every transaction instead of once per run. bbolt locks the file while it is
+// open, so keeping it open would make a second session hang until the first one quits.
+type BoltStore struct{}
+
+const (
+	boltFile = "history.db"
+
+	// boltTimeout is how long to wait for another session to release the file lock.
+	boltTimeout = 5 * time.Second
+)
+
+var (
+	seriesBucket    = []byte("series")
+	progressBucket  = []byte("progress")
+	episodesBucket  = []byte("episodes")
+	settingsBucket  = []byte("settings")
+	downloadsBucket = []byte("downloads")
+	watchlistBucket = []byte("watchlist")
+	sessionsBucket  = []byte("sessions")
+
+	watchlistKey = []byte("entries")
+)
+
+// seriesRecord is a History with its position in the recent order. Lower Order is more recent.
+type seriesRecord struct {
+	History
+	Order int `json:"order"`
+}
+
+func (s *BoltStore) open() (*bolt.DB, error) {
+	dbPath, err := statePath(boltFile)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't find the path: %w", err)
+	}
+
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: boltTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("Failed to open %s: %w", boltFile, err)
+	}
+
+	return db, nil
+}
+
+func (s *BoltStore) view(fn func(tx *bolt.Tx) error) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.View(fn)
+}
+
+func (s *BoltStore) update(fn func(tx *bolt.Tx) error) error {
+	db, err := s.open()
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{seriesBucket, progressBucket, episodesBucket, settingsBucket, downloadsBucket, watchlistBucket, sessionsBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return fn(tx)
+	})
+}
+
+func readLibrary(tx *bolt.Tx) ([]History, error) {
+	series := tx.Bucket(seriesBucket)
+	if series == nil {
+		return nil, nil
+	}
+	progress := tx.Bucket(progressBucket)
+
+	var records []seriesRecord
+	err := series.ForEach(func(key, value []byte) error {
+		var record seriesRecord
+		if err := json.Unmarshal(value, &record); err != nil {
+			return fmt.Errorf("Failed to decode series %s: %w", key, err)
+		}
+
+		record.Episode = make(map[int]EpisodeProgress)
+		if episodes := progress.Bucket(key); episodes != nil {
+			err := episodes.ForEach(func(num, value []byte) error {
+				episodeNum, err := strconv.Atoi(string(num))
+				if err != nil {
+					return nil
+				}
+
+				var prog EpisodeProgress
+				if err := json.Unmarshal(value, &prog); err != nil {
+					return fmt.Errorf("Failed to decode progress of %s: %w", key, err)
+				}
+				record.Episode[episodeNum] = prog
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		records = append(records, record)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Order < records[j].Order
+	})
+
+	library := make([]History, len(records))
+	for i := range records {
+		library[i] = records[i].History
+	}
+	return library, nil
+}
+
+func writeLibrary(tx *bolt.Tx, library []History) error {
+	// Recreating the buckets drops series removed from the library.
+	for _, name := range [][]byte{seriesBucket, progressBucket} {
+		if err := tx.DeleteBucket(name); err != nil && err != bolt.ErrBucketNotFound {
+			return err
+		}
+	}
+	series, err := tx.CreateBucket(seriesBucket)
+	if err != nil {
+		return err
+	}
+	progress, err := tx.CreateBucket(progressBucket)
+	if err != nil {
+		return err
+	}
+
+	for i, h := range library {
+		key := []byte(h.Key())
+
+		record := seriesRecord{History: h, Order: i}
+		record.Episode = nil
+		value, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		if err := series.Put(key, value); err != nil {
+			return err
+		}
+
+		episodes, err := progress.CreateBucketIfNotExists(key)
+		if err != nil {
+			return err
+		}
+		for num, prog := range h.Episode {
+			value, err := json.Marshal(prog)
+			if err != nil {
+				return err
+			}
+			if err := episodes.Put([]byte(strconv.Itoa(num)), value); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *BoltStore) Load() ([]History, error) {
+	var library []History
+	err := s.view(func(tx *bolt.Tx) error {
+		var err error
+		library, err = readLibrary(tx)
+		return err
+	})
+	return library, err
+}
+
+func (s *BoltStore) Save(library []History) error {
+	return s.update(func(tx *bolt.Tx) error {
+		return writeLibrary(tx, library)
+	})
+}
+
+func (s *BoltStore) Update(edit func([]History) ([]History, error)) error {
+	return s.update(func(tx *bolt.Tx) error {
+		library, err := readLibrary(tx)
+		if err != nil {
+			return err
+		}
+
+		library, err = edit(library)
+		if err != nil {
+			return err
+		}
+
+		return writeLibrary(tx, library)
+	})
+}
+
+func (s *BoltStore) UpdateWithSetting(key string, edit func([]History, []byte) ([]History, []byte, error)) error {
+	return s.update(func(tx *bolt.Tx) error {
+		library, err := readLibrary(tx)
+		if err != nil {
+			return err
+		}
+
+		bucket := tx.Bucket(settingsBucket)
+		library, value, err := edit(library, bytes.Clone(bucket.Get([]byte(key))))
+		if err != nil {
+			return err
+		}
+
+		if err := writeLibrary(tx, library); err != nil {
+			return err
+		}
+		return bucket.Put([]byte(key), value)
+	})
+}
+
+func (s *BoltStore) LoadEpisodes(animeID string) ([]hianime.Episodes, bool, error) {
+	var episodes []hianime.Episodes
+	var exists bool
+
+	err := s.view(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(episodesBucket)
+		if bucket == nil {
+			return nil
+		}
+		value := bucket.Get([]byte(animeID))
+		if value == nil {
+			return nil
+		}
+
+		exists = true
+		return json.Unmarshal(value, &episodes)
+	})
+	return episodes, exists, err
+}
+
+func (s *BoltStore) SaveEpisodes(animeID string, episodes []hianime.Episodes) error {
+	value, err := json.Marshal(episodes)
+	if err != nil {
+		return err
+	}
+
+	return s.update(func(tx *bolt.Tx) error {
+		return tx.Bucket(episodesBucket).Put([]byte(animeID), value)
+	})
+}
+
+func readWatchlist(tx *bolt.Tx) ([]WatchlistEntry, error) {
+	bucket := tx.Bucket(watchlistBucket)
+	if bucket == nil {
+		return nil, nil
+	}
+	value := bucket.Get(watchlistKey)
+	if value == nil {
+		return nil, nil
+	}
+
+	var list []WatchlistEntry
+	if err := json.Unmarshal(value, &list); err != nil {
+		return nil, fmt.Errorf("Failed to decode the watchlist: %w", err)
+	}
+	return list, nil
+}
+
+func (s *BoltStore) LoadWatchlist() ([]WatchlistEntry, error) {
+	var list []WatchlistEntry
+	err := s.view(func(tx *bolt.Tx) error {
+		var err error
+		list, err = readWatchlist(tx)
+		return err
+	})
+	return list, err
+}
+
+func (s *BoltStore) UpdateWatchlist(edit func([]WatchlistEntry) ([]WatchlistEntry, error)) error {
+	return s.update(func(tx *bolt.Tx) error {
+		list, err := readWatchlist(tx)
+		if err != nil {
+			return err
+		}
+
+		list, err = edit(list)
+		if err != nil {
+			return err
+		}
+
+		value, err := json.Marshal(list)
+		if err != nil {
+			return err
+		}
+		return tx.Bucket(watchlistBucket).Put(watchlistKey, value)
+	})
+}
+
+func (s *BoltStore) GetSetting(key string) (string, bool, error) {
+	var value string
+	var exists bool
+
+	err := s.view(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(settingsBucket)
+		if bucket == nil {
+			return nil
+		}
+		// string() copies the bytes, which are only valid during the transaction.
+		if raw := bucket.Get([]byte(key)); raw != nil {
+			value, exists = string(raw), true
+		}
+		return nil
+	})
+	return value, exists, err
+}
+
+func (s *BoltStore) SetSetting(key, value string) error {
+	return s.update(func(tx *bolt.Tx) error {
+		return tx.Bucket(settingsBucket).Put([]byte(key), []byte(value))
+	})
+}
+
+func (s *BoltStore) UpdateSetting(key string, edit func([]byte) ([]byte, error)) error {
+	return s.update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(settingsBucket)
+		// Cloned, the bytes are only valid during the transaction and edit may keep them.
+		value, err := edit(bytes.Clone(bucket.Get([]byte(key))))
+		if err != nil {
+			return err
+		}
+		return bucket.Put([]byte(key), value)
+	})
+}
+
+func (s *BoltStore) AddDownload(record DownloadRecord) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return s.update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(downloadsBucket)
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, seq)
+		return bucket.Put(key, value)
+	})
+}
+
+func (s *BoltStore) Downloads() ([]DownloadRecord, error) {
+	var records []DownloadRecord
+	err := s.view(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(downloadsBucket)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(key, value []byte) error {
+			var record DownloadRecord
+			if err := json.Unmarshal(value, &record); err != nil {
+				return err
+			}
+			records = append(records, record)
+			return nil
+		})
+	})
+	return records, err
+}
+
+func (s *BoltStore) AddSession(record SessionRecord) error {
+	value, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	return s.update(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(sessionsBucket)
+		seq, err := bucket.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		key := make([]byte, 8)
+		binary.BigEndian.PutUint64(key, seq)
+		return bucket.Put(key, value)
+	})
+}
+
+func (s *BoltStore) Sessions() ([]SessionRecord, error) {
+	var records []SessionRecord
+	err := s.view(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(sessionsBucket)
+		if bucket == nil {
+			return nil
+		}
+		return bucket.ForEach(func(key, value []byte) error {
+			var record SessionRecord
+			if err := json.Unmarshal(value, &record); err != nil {
+				return err
+			}
+			records = append(records, record)
+			return nil
+		})
+	})
+	return records, err
+}
+
+// importJSON copies the json store into the database the first time it is created.
+// The json files are left in place so switching "storage" back to json still works.
+func (s *BoltStore) importJSON() error {
+	imported := false
+	if err := s.view(func(tx *bolt.Tx) error {
+		imported = tx.Bucket(seriesBucket) != nil
+		return nil
+	}); err != nil {
+		return err
+	}
+	if imported {
+		return nil
+	}
+
+	var library []History
+	var exists bool
+	err := withFile(historyFile, func(filePath string) error {
+		var err error
+		library, exists, err = loadHistoryFile(filePath)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if !exists {
+		// Nothing to import. Creating the buckets marks the import as done.
+		return s.update(func(tx *bolt.Tx) error { return nil })
+	}
+
+	fmt.Printf("--> Importing %d series from %s into %s.\n", len(library), historyFile, boltFile)
+	return s.Save(library)
+}
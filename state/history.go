@@ -1,110 +1,269 @@
 package state
 
 import (
-	"encoding/json"
 	"fmt"
-	"os"
-	"path/filepath"
+	"time"
+
+	"hianime-mpv-go/config"
+	"hianime-mpv-go/hianime"
 )
 
+// ProviderHianime is the only provider for now. It is part of the history key so other sites can't collide with hianime ids.
+const ProviderHianime = "hianime"
+
 type History struct {
-	Url          string                  `json:"url"`
-	JapaneseName string                  `json:"jp_name"`
-	EnglishName  string                  `json:"en_name"`
-	LastEpisode  int                     `json:"last_episode"`
-	AnilistID    string                  `json:"anilist_id"`
-	SubDelay     float64                 `json:"sub_delay"`
-	Volume       int                     `json:"volume"`
-	Episode      map[int]EpisodeProgress `json:"episode_history"`
+	Provider      string                  `json:"provider"`
+	AnimeID       string                  `json:"anime_id"`
+	Url           string                  `json:"url"`
+	JapaneseName  string                  `json:"jp_name"`
+	EnglishName   string                  `json:"en_name"`
+	LastEpisode   int                     `json:"last_episode"`
+	AnilistID     string                  `json:"anilist_id"`
+	MalID         string                  `json:"mal_id,omitempty"`
+	SubDelay      float64                 `json:"sub_delay"`
+	Volume        int                     `json:"volume"`
+	Episode       map[int]EpisodeProgress `json:"episode_history"`
+	Status        string                  `json:"status,omitempty"`
+	Archived      bool                    `json:"archived,omitempty"`
+	KnownEpisodes int                     `json:"known_episodes,omitempty"` // episode count seen by the last new-episode check
+	AudioType     string                  `json:"audio_type,omitempty"`     // server type picked last for this series, tried first
+	SubLanguages  []string                `json:"sub_languages,omitempty"`  // subtitle languages of this series, instead of the config's
 }
 
 type EpisodeProgress struct {
-	Position float64 `json:"position"`
-	Duration float64 `json:"duration"`
+	Position       float64   `json:"position"`
+	Duration       float64   `json:"duration"`
+	UpdatedAt      time.Time `json:"updated_at,omitzero"`
+	Watched        bool      `json:"watched,omitempty"`
+	FirstWatchedAt time.Time `json:"first_watched_at,omitzero"`
+	LastWatchedAt  time.Time `json:"last_watched_at,omitzero"`
+	Rewatches      int       `json:"rewatches,omitempty"` // times the episode was watched to the end again
+	Unmarked       bool      `json:"unmarked,omitempty"`  // watched flag cleared by hand, so the migration doesn't set it again
 }
 
-func getDefaultPath() (string, error) {
-	exePath, err := os.Getwd()
-	if err != nil {
-		return "", fmt.Errorf("Failed to get executable path: %w", err)
+// DefaultWatchedThreshold is how far into an episode counts as having watched it, unless the config says otherwise.
+const DefaultWatchedThreshold = 0.9
+
+// WatchedThreshold is the fraction of an episode after which it is flagged as watched. It is set from the config.
+var WatchedThreshold = DefaultWatchedThreshold
+
+// NewHistory starts a library entry for a series that was never watched.
+func NewHistory(metaData hianime.SeriesData) History {
+	return History{
+		Provider:     ProviderHianime,
+		AnimeID:      metaData.AnimeID,
+		Url:          metaData.SeriesUrl,
+		JapaneseName: metaData.JapaneseName,
+		EnglishName:  metaData.EnglishName,
+		AnilistID:    metaData.AnilistID,
+		MalID:        metaData.MalID,
+		LastEpisode:  1,
+		Episode:      make(map[int]EpisodeProgress),
 	}
-	defaultPath := filepath.Join(exePath, "state")
+}
 
-	if err = os.MkdirAll(defaultPath, 0755); err != nil {
-		return "", fmt.Errorf("Failed to find/create directory: %w", err)
+// Key identifies a series in the library: the provider plus its anime id.
+// Names aren't used because the Japanese name can be missing or shared by the TV and movie entries.
+func (h History) Key() string {
+	provider := h.Provider
+	if provider == "" {
+		provider = ProviderHianime
 	}
 
-	historyPath := filepath.Join(defaultPath, "history.json")
+	id := h.AnimeID
+	if id == "" {
+		id = hianime.AnimeIDFromUrl(h.Url)
+	}
+	if id == "" {
+		return provider + ":" + h.Url
+	}
 
-	return historyPath, nil
+	return provider + ":" + id
 }
 
+// FindHistory returns the library entry of a series, matched by key, with the ids it is missing filled in
+// from metaData.
+func FindHistory(library []History, metaData hianime.SeriesData) (History, bool) {
+	key := NewHistory(metaData).Key()
+	for _, h := range library {
+		if h.Key() == key {
+			h.FillIDs(metaData)
+			return h, true
+		}
+	}
+	return History{}, false
+}
+
+// FillIDs copies the AniList and MyAnimeList ids of metaData into an entry saved before it kept them,
+// or when the site didn't know them yet. It reports whether anything changed.
+func (h *History) FillIDs(metaData hianime.SeriesData) bool {
+	changed := false
+	if h.AnilistID == "" && metaData.AnilistID != "" {
+		h.AnilistID = metaData.AnilistID
+		changed = true
+	}
+	if h.MalID == "" && metaData.MalID != "" {
+		h.MalID = metaData.MalID
+		changed = true
+	}
+	return changed
+}
+
+// UpdateHistory moves targetData to the front of the library, replacing the older entry of the same series.
+// The library keeps every series, the menus only show the most recent ones through Recent.
 func UpdateHistory(currentHistory []History, targetData History) []History {
 	var cleaned []History
 
+	targetKey := targetData.Key()
 	for i := range currentHistory {
-		if currentHistory[i].JapaneseName != targetData.JapaneseName {
+		if currentHistory[i].Key() != targetKey {
 			cleaned = append(cleaned, currentHistory[i])
 		}
 	}
 
-	newHistory := append([]History{targetData}, cleaned...)
-
-	if len(newHistory) > 10 {
-		newHistory = newHistory[:10]
-	}
+	// Picking a series again brings it back from the archive.
+	targetData.Archived = false
 
-	return newHistory
+	return append([]History{targetData}, cleaned...)
 }
 
-func SaveHistory(rawData []History) error {
-	jsonData, err := json.MarshalIndent(rawData, "", " ")
+// LoadHistory reads the whole library from the configured store, upgrading entries saved by older versions.
+func LoadHistory() ([]History, error) {
+	historySession, err := DefaultStore.Load()
 	if err != nil {
-		return fmt.Errorf("Failed to save the history files: %w", err)
+		return historySession, err
 	}
-
-	historyPath, err := getDefaultPath()
-	if err != nil {
-		return fmt.Errorf("Couldn't find the path: %w", err)
+	if config.DebugMode {
+		fmt.Println("File history load success.")
 	}
 
-	if err = os.WriteFile(historyPath, jsonData, os.ModePerm); err != nil {
-		return fmt.Errorf("Failed to write history files: %w", err)
+	migrated, changed := MigrateHistory(historySession)
+	if changed {
+		historySession = migrated
+		if err := SaveHistory(historySession); err != nil {
+			return historySession, fmt.Errorf("Failed to save migrated history: %w", err)
+		}
 	}
 
-	return nil
+	return historySession, nil
 }
 
-func LoadHistory() ([]History, error) {
-	var historySession []History
+// SaveHistory replaces the whole stored library with rawData.
+func SaveHistory(rawData []History) error {
+	return DefaultStore.Save(rawData)
+}
 
-	historyPath, err := getDefaultPath()
-	if err != nil {
-		return historySession, fmt.Errorf("Couldn't find the path: %w", err)
+// SaveSeries stores one series as the most recent entry and returns the library as it is now stored.
+// Only that series is replaced, so changes made meanwhile by another session to other series are kept.
+func SaveSeries(targetData History) ([]History, error) {
+	return UpdateLibrary(func(library []History) ([]History, error) {
+		return UpdateHistory(library, targetData), nil
+	})
+}
+
+// UpdateLibrary runs edit on the stored library in a single transaction and saves the result.
+func UpdateLibrary(edit func([]History) ([]History, error)) ([]History, error) {
+	var updated []History
+	err := DefaultStore.Update(func(library []History) ([]History, error) {
+		var err error
+		updated, err = edit(library)
+		return updated, err
+	})
+	return updated, err
+}
+
+// RecordProgress stores the playback position of an episode along with the sub delay and volume used while
+// watching it. A volume of 0, not reported, keeps the one stored.
+// The episode is flagged as watched once position passes the watched threshold or outroStart, when it is known.
+// Watching an already watched episode to the end again counts as a rewatch.
+func (h *History) RecordProgress(episodeNum int, position, duration, outroStart, subDelay float64, volume int) {
+	if h.Episode == nil {
+		h.Episode = make(map[int]EpisodeProgress)
 	}
 
-	if _, err := os.Stat(historyPath); err == nil {
-		fmt.Println("File history load success.")
-		jsonData, err := os.ReadFile(historyPath)
-		if err != nil {
-			return historySession, fmt.Errorf("Failed to open json files: %w", err)
-		}
+	now := time.Now()
+	h.SubDelay = subDelay
+	if volume > 0 {
+		h.Volume = volume
+	}
 
-		if err = json.Unmarshal(jsonData, &historySession); err != nil {
-			return historySession, fmt.Errorf("Failed to convert to struct: %w", err)
+	prog := h.Episode[episodeNum]
+	prog.Position = position
+	prog.Duration = duration
+	prog.UpdatedAt = now
+
+	if reachedEnd(position, duration, outroStart) {
+		if prog.Watched {
+			prog.Rewatches++
 		}
+		prog.setWatched(now)
+	}
+	h.Episode[episodeNum] = prog
+}
 
-	} else if os.IsNotExist(err) {
-		_, err := os.Create(historyPath)
+// reachedEnd reports whether playback stopped late enough for the episode to count as watched.
+func reachedEnd(position, duration, outroStart float64) bool {
+	if outroStart > 0 && position >= outroStart {
+		return true
+	}
+	return duration > 0 && position >= duration*WatchedThreshold
+}
 
-		SaveHistory(historySession)
+// MarkWatched flags an episode as watched without playing it. It reports false when it already was.
+func (h *History) MarkWatched(num int, at time.Time) bool {
+	if h.Episode == nil {
+		h.Episode = make(map[int]EpisodeProgress)
+	}
 
-		if err != nil {
-			return historySession, fmt.Errorf("Failed to create history json file: %w", err)
-		}
-	} else {
-		return historySession, fmt.Errorf("Error accessing path %s: %w\n", historyPath, err)
+	prog := h.Episode[num]
+	if prog.Watched {
+		return false
 	}
+	prog.setWatched(at)
+	prog.UpdatedAt = at
+	h.Episode[num] = prog
+	return true
+}
 
-	return historySession, nil
+// UnmarkWatched clears the watched flag of an episode. Its position, watch times and rewatches are kept.
+// It reports false when the episode wasn't watched.
+func (h *History) UnmarkWatched(num int, at time.Time) bool {
+	prog, exists := h.Episode[num]
+	if !exists || !prog.Watched {
+		return false
+	}
+	prog.Watched = false
+	prog.Unmarked = true
+	prog.UpdatedAt = at
+	h.Episode[num] = prog
+	return true
+}
+
+// MarkWatchedThrough flags the episodes up to num as watched, for progress imported from a tracker.
+func (h *History) MarkWatchedThrough(num int, at time.Time) {
+	for n := 1; n <= num; n++ {
+		h.MarkWatched(n, at)
+	}
+	if h.LastEpisode < num {
+		h.LastEpisode = num
+	}
+}
+
+func (p *EpisodeProgress) setWatched(at time.Time) {
+	p.Watched = true
+	p.Unmarked = false
+	if p.FirstWatchedAt.IsZero() {
+		p.FirstWatchedAt = at
+	}
+	p.LastWatchedAt = at
+}
+
+// Finished reports whether the episode was watched, either to the end or marked by hand.
+func (p EpisodeProgress) Finished() bool {
+	return p.Watched
+}
+
+// Partial reports whether the episode was started but not watched to the end.
+func (p EpisodeProgress) Partial() bool {
+	return !p.Watched && p.Position > 0
 }
@@ -0,0 +1,153 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	"hianime-mpv-go/hianime"
+)
+
+func TestUpdateHistorySharedJapaneseName(t *testing.T) {
+	tv := History{Url: "https://hianime.to/frieren-18542", JapaneseName: "Sousou no Frieren"}
+	movie := History{Url: "https://hianime.to/frieren-movie-19777", JapaneseName: "Sousou no Frieren"}
+
+	library := UpdateHistory(nil, tv)
+	library = UpdateHistory(library, movie)
+
+	if len(library) != 2 {
+		t.Fatalf("got %d entries, want 2", len(library))
+	}
+	if library[0].Url != movie.Url || library[1].Url != tv.Url {
+		t.Errorf("got %s, %s; want the movie first", library[0].Url, library[1].Url)
+	}
+}
+
+func TestUpdateHistoryEmptyJapaneseName(t *testing.T) {
+	a := History{Url: "https://hianime.to/one-piece-100"}
+	b := History{Url: "https://hianime.to/naruto-677"}
+
+	library := UpdateHistory(UpdateHistory(nil, a), b)
+	if len(library) != 2 {
+		t.Fatalf("got %d entries, want 2", len(library))
+	}
+
+	// The same series again replaces its entry instead of adding one.
+	a.LastEpisode = 5
+	library = UpdateHistory(library, a)
+	if len(library) != 2 || library[0].Url != a.Url || library[0].LastEpisode != 5 {
+		t.Errorf("got %+v, want %s first with episode 5", library, a.Url)
+	}
+}
+
+func TestMigrateHistoryMergesDuplicateUrls(t *testing.T) {
+	older := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(24 * time.Hour)
+
+	library := []History{
+		{
+			Url:         "https://hianime.to/one-piece-100",
+			LastEpisode: 3,
+			Episode: map[int]EpisodeProgress{
+				3: {Position: 600, Duration: 1400, UpdatedAt: newer},
+			},
+		},
+		{Url: "https://hianime.to/naruto-677", LastEpisode: 1},
+		{
+			Url:          "https://hianime.to/one-piece-100",
+			JapaneseName: "One Piece",
+			MalID:        "21",
+			LastEpisode:  2,
+			Episode: map[int]EpisodeProgress{
+				2: {Position: 100, Duration: 1400, UpdatedAt: older},
+				3: {Position: 60, Duration: 1400, UpdatedAt: older},
+			},
+		},
+	}
+
+	migrated, changed := MigrateHistory(library)
+	if !changed {
+		t.Error("changed = false, want true")
+	}
+	if len(migrated) != 2 {
+		t.Fatalf("got %d entries, want 2", len(migrated))
+	}
+
+	merged := migrated[0]
+	if merged.AnimeID != "100" || merged.Provider != ProviderHianime {
+		t.Errorf("got key %s, want hianime:100", merged.Key())
+	}
+	if merged.LastEpisode != 3 {
+		t.Errorf("LastEpisode = %d, want 3", merged.LastEpisode)
+	}
+	if merged.Episode[3].Position != 600 {
+		t.Errorf("episode 3 at %v, want the newest progress 600", merged.Episode[3].Position)
+	}
+	if _, ok := merged.Episode[2]; !ok {
+		t.Error("episode 2, only known to the older entry, was lost")
+	}
+	if merged.JapaneseName != "One Piece" || merged.MalID != "21" {
+		t.Errorf("got %q / %q, want the names and ids of the older entry filled in", merged.JapaneseName, merged.MalID)
+	}
+}
+
+func TestFindHistoryFillsMissingIDs(t *testing.T) {
+	library := []History{{AnimeID: "100", Url: "https://hianime.to/one-piece-100", AnilistID: "21"}}
+	metaData := hianime.SeriesData{AnimeID: "100", SeriesUrl: "https://hianime.to/one-piece-100", AnilistID: "99", MalID: "21"}
+
+	h, exists := FindHistory(library, metaData)
+	if !exists {
+		t.Fatal("series not found")
+	}
+	if h.MalID != "21" {
+		t.Errorf("MalID = %q, want it filled in from the metadata", h.MalID)
+	}
+	if h.AnilistID != "21" {
+		t.Errorf("AnilistID = %q, want the stored id kept", h.AnilistID)
+	}
+}
+
+func TestUnmarkWatchedKeepsProgress(t *testing.T) {
+	watchedAt := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	h := History{Url: "https://hianime.to/one-piece-100", Episode: map[int]EpisodeProgress{
+		3: {Position: 1350, Duration: 1400, UpdatedAt: watchedAt, Watched: true, FirstWatchedAt: watchedAt, LastWatchedAt: watchedAt, Rewatches: 2},
+	}}
+
+	now := watchedAt.Add(time.Hour)
+	if !h.UnmarkWatched(3, now) {
+		t.Fatal("UnmarkWatched = false, want true")
+	}
+	if h.UnmarkWatched(4, now) {
+		t.Error("UnmarkWatched of an unknown episode = true, want false")
+	}
+
+	prog := h.Episode[3]
+	if prog.Watched || prog.Position != 1350 || prog.FirstWatchedAt != watchedAt || prog.Rewatches != 2 || !prog.UpdatedAt.Equal(now) {
+		t.Errorf("got %+v, want only the watched flag cleared", prog)
+	}
+
+	// Played past the threshold, but unmarked by hand: the migration leaves it unwatched.
+	migrated, _ := MigrateHistory([]History{h})
+	if migrated[0].Episode[3].Watched {
+		t.Error("the migration flagged the unmarked episode as watched again")
+	}
+
+	h.MarkWatched(3, now)
+	if prog := h.Episode[3]; !prog.Watched || prog.Unmarked {
+		t.Errorf("got %+v, want watched again", prog)
+	}
+}
+
+func TestRecordProgressKeepsVolume(t *testing.T) {
+	h := History{Url: "https://hianime.to/one-piece-100"}
+
+	h.RecordProgress(1, 300, 1400, 0, 0.5, 80)
+	if h.Volume != 80 || h.SubDelay != 0.5 {
+		t.Fatalf("got volume %d sub delay %v, want 80 and 0.5", h.Volume, h.SubDelay)
+	}
+
+	// mpv didn't report a volume this time.
+	h.RecordProgress(2, 300, 1400, 0, 0.5, 0)
+	if h.Volume != 80 {
+		t.Errorf("volume %d, want 80 kept", h.Volume)
+	}
+}
@@ -0,0 +1,290 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+
+	"hianime-mpv-go/hianime"
+	"hianime-mpv-go/safefile"
+)
+
+// JSONStore keeps each kind of data in its own json file inside the state directory.
+// Every save rewrites the whole file atomically while holding the file's lock.
+type JSONStore struct{}
+
+const (
+	historyFile   = "history.json"
+	episodesFile  = "episodes.json"
+	settingsFile  = "settings.json"
+	downloadsFile = "downloads.json"
+	watchlistFile = "watchlist.json"
+	sessionsFile  = "sessions.json"
+)
+
+// HistorySchemaVersion is the current schema_version of history.json.
+//
+//	1: a bare list of series, deduplicated by Japanese name
+//	2: {"schema_version": 2, "history": [...]}, series keyed by provider and anime id
+const HistorySchemaVersion = 2
+
+var historySchema = safefile.Schema{
+	Current: HistorySchemaVersion,
+	Migrations: map[int]safefile.Migration{
+		1: func(data []byte) ([]byte, error) {
+			var library []History
+			if err := json.Unmarshal(data, &library); err != nil {
+				return nil, err
+			}
+			library, _ = MigrateHistory(library)
+			return json.MarshalIndent(historyDocument{SchemaVersion: 2, History: library}, "", " ")
+		},
+	},
+}
+
+type historyDocument struct {
+	SchemaVersion int       `json:"schema_version"`
+	History       []History `json:"history"`
+}
+
+// withFile runs fn holding the lock of the state file name, passing its full path.
+func withFile(name string, fn func(filePath string) error) error {
+	filePath, err := statePath(name)
+	if err != nil {
+		return fmt.Errorf("Couldn't find the path: %w", err)
+	}
+
+	return safefile.WithLock(filePath, func() error {
+		return fn(filePath)
+	})
+}
+
+// readJSON decodes the file into v. A missing file leaves v untouched and reports false. The lock must be held.
+func readJSON(filePath string, schema safefile.Schema, v any) (bool, error) {
+	return safefile.Load(filePath, schema, func(data []byte) error {
+		return json.Unmarshal(data, v)
+	})
+}
+
+// writeJSON encodes v into the file. The lock must be held.
+func writeJSON(filePath string, v any) error {
+	jsonData, err := json.MarshalIndent(v, "", " ")
+	if err != nil {
+		return fmt.Errorf("Failed to save the %s file: %w", filepath.Base(filePath), err)
+	}
+
+	return safefile.Write(filePath, jsonData)
+}
+
+func loadHistoryFile(filePath string) ([]History, bool, error) {
+	var doc historyDocument
+	exists, err := readJSON(filePath, historySchema, &doc)
+	return doc.History, exists, err
+}
+
+func saveHistoryFile(filePath string, library []History) error {
+	if library == nil {
+		library = []History{}
+	}
+	return writeJSON(filePath, historyDocument{SchemaVersion: HistorySchemaVersion, History: library})
+}
+
+func (s *JSONStore) Load() ([]History, error) {
+	var library []History
+	err := withFile(historyFile, func(filePath string) error {
+		var exists bool
+		var err error
+		library, exists, err = loadHistoryFile(filePath)
+		if err != nil || exists {
+			return err
+		}
+		return saveHistoryFile(filePath, library)
+	})
+	return library, err
+}
+
+func (s *JSONStore) Save(library []History) error {
+	return withFile(historyFile, func(filePath string) error {
+		return saveHistoryFile(filePath, library)
+	})
+}
+
+func (s *JSONStore) Update(edit func([]History) ([]History, error)) error {
+	return withFile(historyFile, func(filePath string) error {
+		library, _, err := loadHistoryFile(filePath)
+		if err != nil {
+			return err
+		}
+
+		library, err = edit(library)
+		if err != nil {
+			return err
+		}
+
+		return saveHistoryFile(filePath, library)
+	})
+}
+
+// UpdateWithSetting holds the history lock, then the settings lock, the order every caller takes them in.
+func (s *JSONStore) UpdateWithSetting(key string, edit func([]History, []byte) ([]History, []byte, error)) error {
+	return withFile(historyFile, func(historyPath string) error {
+		return withFile(settingsFile, func(settingsPath string) error {
+			library, _, err := loadHistoryFile(historyPath)
+			if err != nil {
+				return err
+			}
+			settings := make(map[string]string)
+			if _, err := readJSON(settingsPath, safefile.Schema{}, &settings); err != nil {
+				return err
+			}
+
+			var current []byte
+			if value, exists := settings[key]; exists {
+				current = []byte(value)
+			}
+			library, value, err := edit(library, current)
+			if err != nil {
+				return err
+			}
+
+			if err := saveHistoryFile(historyPath, library); err != nil {
+				return err
+			}
+			settings[key] = string(value)
+			return writeJSON(settingsPath, settings)
+		})
+	})
+}
+
+func (s *JSONStore) LoadEpisodes(animeID string) ([]hianime.Episodes, bool, error) {
+	cache := make(map[string][]hianime.Episodes)
+	err := withFile(episodesFile, func(filePath string) error {
+		_, err := readJSON(filePath, safefile.Schema{}, &cache)
+		return err
+	})
+
+	episodes, exists := cache[animeID]
+	return episodes, exists, err
+}
+
+func (s *JSONStore) SaveEpisodes(animeID string, episodes []hianime.Episodes) error {
+	return withFile(episodesFile, func(filePath string) error {
+		cache := make(map[string][]hianime.Episodes)
+		if _, err := readJSON(filePath, safefile.Schema{}, &cache); err != nil {
+			return err
+		}
+
+		cache[animeID] = episodes
+		return writeJSON(filePath, cache)
+	})
+}
+
+func (s *JSONStore) LoadWatchlist() ([]WatchlistEntry, error) {
+	var list []WatchlistEntry
+	err := withFile(watchlistFile, func(filePath string) error {
+		_, err := readJSON(filePath, safefile.Schema{}, &list)
+		return err
+	})
+	return list, err
+}
+
+func (s *JSONStore) UpdateWatchlist(edit func([]WatchlistEntry) ([]WatchlistEntry, error)) error {
+	return withFile(watchlistFile, func(filePath string) error {
+		var list []WatchlistEntry
+		if _, err := readJSON(filePath, safefile.Schema{}, &list); err != nil {
+			return err
+		}
+
+		list, err := edit(list)
+		if err != nil {
+			return err
+		}
+		if list == nil {
+			list = []WatchlistEntry{}
+		}
+		return writeJSON(filePath, list)
+	})
+}
+
+func (s *JSONStore) GetSetting(key string) (string, bool, error) {
+	settings := make(map[string]string)
+	err := withFile(settingsFile, func(filePath string) error {
+		_, err := readJSON(filePath, safefile.Schema{}, &settings)
+		return err
+	})
+
+	value, exists := settings[key]
+	return value, exists, err
+}
+
+func (s *JSONStore) SetSetting(key, value string) error {
+	return withFile(settingsFile, func(filePath string) error {
+		settings := make(map[string]string)
+		if _, err := readJSON(filePath, safefile.Schema{}, &settings); err != nil {
+			return err
+		}
+
+		settings[key] = value
+		return writeJSON(filePath, settings)
+	})
+}
+
+func (s *JSONStore) UpdateSetting(key string, edit func([]byte) ([]byte, error)) error {
+	return withFile(settingsFile, func(filePath string) error {
+		settings := make(map[string]string)
+		if _, err := readJSON(filePath, safefile.Schema{}, &settings); err != nil {
+			return err
+		}
+
+		var current []byte
+		if value, exists := settings[key]; exists {
+			current = []byte(value)
+		}
+		value, err := edit(current)
+		if err != nil {
+			return err
+		}
+		settings[key] = string(value)
+		return writeJSON(filePath, settings)
+	})
+}
+
+func (s *JSONStore) AddDownload(record DownloadRecord) error {
+	return withFile(downloadsFile, func(filePath string) error {
+		var records []DownloadRecord
+		if _, err := readJSON(filePath, safefile.Schema{}, &records); err != nil {
+			return err
+		}
+
+		return writeJSON(filePath, append(records, record))
+	})
+}
+
+func (s *JSONStore) Downloads() ([]DownloadRecord, error) {
+	var records []DownloadRecord
+	err := withFile(downloadsFile, func(filePath string) error {
+		_, err := readJSON(filePath, safefile.Schema{}, &records)
+		return err
+	})
+	return records, err
+}
+
+func (s *JSONStore) AddSession(record SessionRecord) error {
+	return withFile(sessionsFile, func(filePath string) error {
+		var records []SessionRecord
+		if _, err := readJSON(filePath, safefile.Schema{}, &records); err != nil {
+			return err
+		}
+
+		return writeJSON(filePath, append(records, record))
+	})
+}
+
+func (s *JSONStore) Sessions() ([]SessionRecord, error) {
+	var records []SessionRecord
+	err := withFile(sessionsFile, func(filePath string) error {
+		_, err := readJSON(filePath, safefile.Schema{}, &records)
+		return err
+	})
+	return records, err
+}
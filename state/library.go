@@ -0,0 +1,155 @@
+package state
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RecentLimit is how many series the "Recent History" menus show.
+const RecentLimit = 10
+
+// Library statuses. An empty status counts as watching, so entries saved before statuses existed keep working.
+const (
+	StatusWatching  = "watching"
+	StatusCompleted = "completed"
+	StatusDropped   = "dropped"
+)
+
+var Statuses = []string{StatusWatching, StatusCompleted, StatusDropped}
+
+// LibraryFilter narrows a library listing. Zero values match everything except archived entries.
+type LibraryFilter struct {
+	Status   string
+	Query    string
+	Archived bool // list archived entries instead of active ones
+}
+
+// GetStatus returns the status of the entry, defaulting to watching.
+func (h History) GetStatus() string {
+	if h.Status == "" {
+		return StatusWatching
+	}
+	return h.Status
+}
+
+func ValidStatus(status string) bool {
+	for _, s := range Statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Recent returns the n most recently watched series that aren't archived.
+func Recent(library []History, n int) []History {
+	var recent []History
+	for _, h := range library {
+		if h.Archived {
+			continue
+		}
+		recent = append(recent, h)
+		if len(recent) == n {
+			break
+		}
+	}
+	return recent
+}
+
+// FilterLibrary returns the entries matching filter, most recent first.
+func FilterLibrary(library []History, filter LibraryFilter) []History {
+	query := strings.ToLower(strings.TrimSpace(filter.Query))
+
+	var filtered []History
+	for _, h := range library {
+		if h.Archived != filter.Archived {
+			continue
+		}
+		if filter.Status != "" && h.GetStatus() != filter.Status {
+			continue
+		}
+		if query != "" && !strings.Contains(strings.ToLower(h.JapaneseName), query) && !strings.Contains(strings.ToLower(h.EnglishName), query) {
+			continue
+		}
+		filtered = append(filtered, h)
+	}
+	return filtered
+}
+
+// FindEntry resolves ref, either a series url or a 1-based position in the full library, to an index in library.
+func FindEntry(library []History, ref string) (int, error) {
+	if num, err := strconv.Atoi(ref); err == nil {
+		if num < 1 || num > len(library) {
+			return -1, fmt.Errorf("Library number %d is out of range (1-%d)", num, len(library))
+		}
+		return num - 1, nil
+	}
+
+	key := History{Url: ref}.Key()
+	for i := range library {
+		if library[i].Key() == key {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("'%s' isn't in the library", ref)
+}
+
+// SetStatus changes the status of an entry without moving it to the front.
+func SetStatus(library []History, ref string, status string) ([]History, error) {
+	if !ValidStatus(status) {
+		return library, fmt.Errorf("Unknown status '%s', use one of %s", status, strings.Join(Statuses, ", "))
+	}
+
+	i, err := FindEntry(library, ref)
+	if err != nil {
+		return library, err
+	}
+
+	library[i].Status = status
+	return library, nil
+}
+
+// SetArchived hides an entry from the recent menus, or brings it back, without losing its progress.
+func SetArchived(library []History, ref string, archived bool) ([]History, error) {
+	i, err := FindEntry(library, ref)
+	if err != nil {
+		return library, err
+	}
+
+	library[i].Archived = archived
+	return library, nil
+}
+
+// SetLanguages sets the server type an entry tries first and the subtitle languages it loads.
+// Empty values fall back to the config.
+func SetLanguages(library []History, ref string, audioType string, subLanguages []string) ([]History, error) {
+	i, err := FindEntry(library, ref)
+	if err != nil {
+		return library, err
+	}
+
+	library[i].AudioType = audioType
+	library[i].SubLanguages = subLanguages
+	return library, nil
+}
+
+// SetWatched marks the given episodes of an entry as watched, or clears the flag, and returns how many changed.
+func SetWatched(library []History, ref string, episodes []int, watched bool) ([]History, int, error) {
+	i, err := FindEntry(library, ref)
+	if err != nil {
+		return library, 0, err
+	}
+
+	changed := 0
+	now := time.Now()
+	for _, num := range episodes {
+		if watched && library[i].MarkWatched(num, now) {
+			changed++
+		} else if !watched && library[i].UnmarkWatched(num, now) {
+			changed++
+		}
+	}
+	return library, changed, nil
+}
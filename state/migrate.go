@@ -0,0 +1,93 @@
+package state
+
+import "hianime-mpv-go/hianime"
+
+// MigrateHistory fills in the provider and anime id of entries saved before history was keyed by id,
+// and merges entries that turn out to be the same series. Older files deduplicated on the Japanese name,
+// so the same url can appear twice. Episodes saved before the watched flag existed get it from their position.
+// It reports whether anything changed.
+func MigrateHistory(library []History) ([]History, bool) {
+	changed := false
+	byKey := make(map[string]int, len(library))
+
+	var migrated []History
+	for _, h := range library {
+		if h.Provider == "" {
+			h.Provider = ProviderHianime
+			changed = true
+		}
+		if h.AnimeID == "" {
+			if id := hianime.AnimeIDFromUrl(h.Url); id != "" {
+				h.AnimeID = id
+				changed = true
+			}
+		}
+
+		if migrateWatched(h.Episode) {
+			changed = true
+		}
+
+		key := h.Key()
+		if i, exists := byKey[key]; exists {
+			// The library is ordered most recent first, so the entry kept is the newer one.
+			migrated[i] = mergeHistory(migrated[i], h)
+			changed = true
+			continue
+		}
+
+		byKey[key] = len(migrated)
+		migrated = append(migrated, h)
+	}
+
+	return migrated, changed
+}
+
+// migrateWatched flags the episodes saved by older versions, which had no watched flag, that were played
+// past the watched threshold. Newer saves set the flag themselves, so this only ever touches old episodes.
+func migrateWatched(episodes map[int]EpisodeProgress) bool {
+	changed := false
+	for num, prog := range episodes {
+		if prog.Watched || prog.Unmarked || prog.Duration <= 0 || prog.Position < prog.Duration*WatchedThreshold {
+			continue
+		}
+		prog.Watched = true
+		prog.FirstWatchedAt = prog.UpdatedAt
+		prog.LastWatchedAt = prog.UpdatedAt
+		episodes[num] = prog
+		changed = true
+	}
+	return changed
+}
+
+// mergeHistory keeps newer's fields and adds the episode progress only older knows about.
+func mergeHistory(newer, older History) History {
+	if newer.Episode == nil {
+		newer.Episode = make(map[int]EpisodeProgress)
+	}
+	for num, prog := range older.Episode {
+		if _, exists := newer.Episode[num]; !exists {
+			newer.Episode[num] = prog
+		}
+	}
+
+	if newer.JapaneseName == "" {
+		newer.JapaneseName = older.JapaneseName
+	}
+	if newer.EnglishName == "" {
+		newer.EnglishName = older.EnglishName
+	}
+	if newer.AnilistID == "" {
+		newer.AnilistID = older.AnilistID
+	}
+	if newer.MalID == "" {
+		newer.MalID = older.MalID
+	}
+	if newer.SubDelay == 0 {
+		newer.SubDelay = older.SubDelay
+	}
+	if newer.Volume == 0 {
+		newer.Volume = older.Volume
+	}
+
+	return newer
+}
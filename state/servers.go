@@ -0,0 +1,131 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+)
+
+// ServerStatsSetting is the store setting holding the statistics of the servers.
+const ServerStatsSetting = "server_stats"
+
+// ScoreHalfLife is how long it takes for an attempt to count half as much in the score of a server.
+const ScoreHalfLife = 7 * 24 * time.Hour
+
+// Stages of playing a server.
+const (
+	StageResolve = "resolve" // fetching the stream data
+	StageStart   = "start"   // mpv opening the stream
+)
+
+// ServerStats is what past attempts tell about a server, by server name.
+type ServerStats struct {
+	Name          string    `json:"name"`
+	Resolved      int       `json:"resolved"`       // stream data fetched
+	ResolveFailed int       `json:"resolve_failed"` // stream data missing or failed to fetch
+	Started       int       `json:"started"`        // mpv played the stream
+	StartFailed   int       `json:"start_failed"`   // mpv couldn't play the stream
+	FirstFrame    float64   `json:"first_frame"`    // seconds mpv took to show the first frame, summed over Started
+	Successes     float64   `json:"successes"`      // successful stages, decayed to UpdatedAt
+	Attempts      float64   `json:"attempts"`       // stages, decayed to UpdatedAt
+	UpdatedAt     time.Time `json:"updated_at"`
+	LastSuccess   time.Time `json:"last_success,omitzero"`
+	LastFailure   time.Time `json:"last_failure,omitzero"`
+}
+
+// decay returns the factor older attempts are worth at now.
+func (s ServerStats) decay(now time.Time) float64 {
+	if s.UpdatedAt.IsZero() || !now.After(s.UpdatedAt) {
+		return 1
+	}
+	return math.Pow(0.5, float64(now.Sub(s.UpdatedAt))/float64(ScoreHalfLife))
+}
+
+// Score is the chance a server works, from 0 to 1, recent attempts counting the most.
+// A server never tried scores 0.5.
+func (s ServerStats) Score(now time.Time) float64 {
+	d := s.decay(now)
+	return (s.Successes*d + 1) / (s.Attempts*d + 2)
+}
+
+// AverageFirstFrame is the average number of seconds mpv took to show the first frame, 0 when never started.
+func (s ServerStats) AverageFirstFrame() float64 {
+	if s.Started == 0 {
+		return 0
+	}
+	return s.FirstFrame / float64(s.Started)
+}
+
+// Record adds the outcome of one stage. firstFrame only counts for a successful start.
+func (s *ServerStats) Record(stage string, ok bool, firstFrame time.Duration, now time.Time) {
+	d := s.decay(now)
+	s.Successes *= d
+	s.Attempts *= d
+	s.Attempts++
+	s.UpdatedAt = now
+
+	if ok {
+		s.Successes++
+		s.LastSuccess = now
+	} else {
+		s.LastFailure = now
+	}
+
+	switch {
+	case stage == StageResolve && ok:
+		s.Resolved++
+	case stage == StageResolve:
+		s.ResolveFailed++
+	case ok:
+		s.Started++
+		s.FirstFrame += firstFrame.Seconds()
+	default:
+		s.StartFailed++
+	}
+}
+
+// ServerKey is the name a server is known by in the statistics.
+func ServerKey(name string) string {
+	return strings.TrimSpace(name)
+}
+
+// LoadServerStats returns the statistics of every server tried, by server name.
+func LoadServerStats() (map[string]ServerStats, error) {
+	raw, _, err := DefaultStore.GetSetting(ServerStatsSetting)
+	if err != nil {
+		return make(map[string]ServerStats), err
+	}
+	return decodeServerStats([]byte(raw))
+}
+
+func decodeServerStats(raw []byte) (map[string]ServerStats, error) {
+	stats := make(map[string]ServerStats)
+	if len(raw) == 0 {
+		return stats, nil
+	}
+	if err := json.Unmarshal(raw, &stats); err != nil {
+		return stats, fmt.Errorf("Failed to decode the server statistics: %w", err)
+	}
+	return stats, nil
+}
+
+// RecordServerAttempt adds the outcome of one stage of playing a server to its statistics. It runs as one
+// store transaction, so sessions playing at the same time don't lose each other's attempts.
+func RecordServerAttempt(name, stage string, ok bool, firstFrame time.Duration) error {
+	return DefaultStore.UpdateSetting(ServerStatsSetting, func(raw []byte) ([]byte, error) {
+		stats, err := decodeServerStats(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		key := ServerKey(name)
+		s := stats[key]
+		s.Name = key
+		s.Record(stage, ok, firstFrame, time.Now())
+		stats[key] = s
+
+		return json.Marshal(stats)
+	})
+}
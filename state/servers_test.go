@@ -0,0 +1,57 @@
+package state
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"hianime-mpv-go/paths"
+)
+
+func TestRecordServerAttemptConcurrent(t *testing.T) {
+	for _, store := range []Store{&BoltStore{}, &JSONStore{}} {
+		paths.DataDir = t.TempDir()
+		DefaultStore = store
+
+		const attempts = 20
+		var wg sync.WaitGroup
+		for i := range attempts {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := RecordServerAttempt("HD-1", StageResolve, i%4 != 0, 0); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		stats, err := LoadServerStats()
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := stats["HD-1"]
+		if s.Resolved != 15 || s.ResolveFailed != 5 {
+			t.Errorf("%T: got %d resolved and %d failed, want 15 and 5", store, s.Resolved, s.ResolveFailed)
+		}
+		if score := s.Score(s.UpdatedAt); score < 0.7 || score > 0.75 {
+			t.Errorf("%T: score %v, want (15+1)/(20+2)", store, score)
+		}
+	}
+	paths.DataDir = ""
+	DefaultStore = &JSONStore{}
+}
+
+func TestServerScoreDecays(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	var s ServerStats
+	for range 10 {
+		s.Record(StageStart, false, 0, now)
+	}
+	if score := s.Score(now); score > 0.1 {
+		t.Fatalf("score %v after 10 failures, want below 0.1", score)
+	}
+	if score := s.Score(now.Add(10 * ScoreHalfLife)); score < 0.45 {
+		t.Errorf("score %v long after the failures, want back near 0.5", score)
+	}
+}
@@ -0,0 +1,24 @@
+package state
+
+import "time"
+
+// SessionRecord is one playback of an episode, kept for the viewing statistics.
+type SessionRecord struct {
+	SeriesKey string    `json:"series_key"`
+	Series    string    `json:"series"` // name of the series when it was played
+	Episode   int       `json:"episode"`
+	StartedAt time.Time `json:"started_at"`
+	EndedAt   time.Time `json:"ended_at"`
+	Seconds   float64   `json:"seconds"`  // seconds of the episode played
+	Finished  bool      `json:"finished"` // the episode was watched to the end during the session
+}
+
+// AddSession records a playback in the configured store.
+func AddSession(record SessionRecord) error {
+	return DefaultStore.AddSession(record)
+}
+
+// LoadSessions returns every recorded playback, oldest first.
+func LoadSessions() ([]SessionRecord, error) {
+	return DefaultStore.Sessions()
+}
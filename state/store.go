@@ -0,0 +1,86 @@
+package state
+
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"hianime-mpv-go/hianime"
+	"hianime-mpv-go/paths"
+)
+
+// Storage backends accepted by the "storage" config key.
+const (
+	StorageBolt = "bolt"
+	StorageJSON = "json"
+)
+
+// Store is where the library and everything around it is persisted.
+type Store interface {
+	Load() ([]History, error)
+	Save(library []History) error
+	// Update loads the library, applies edit and saves the result as one transaction.
+	Update(edit func([]History) ([]History, error)) error
+	// UpdateWithSetting is Update with a setting, nil when unset, read and stored in the same transaction.
+	UpdateWithSetting(key string, edit func([]History, []byte) ([]History, []byte, error)) error
+
+	// Episode lists fetched from hianime, keyed by AnimeID.
+	LoadEpisodes(animeID string) ([]hianime.Episodes, bool, error)
+	SaveEpisodes(animeID string, episodes []hianime.Episodes) error
+
+	LoadWatchlist() ([]WatchlistEntry, error)
+	UpdateWatchlist(edit func([]WatchlistEntry) ([]WatchlistEntry, error)) error
+
+	GetSetting(key string) (string, bool, error)
+	SetSetting(key, value string) error
+	// UpdateSetting reads a setting, nil when unset, applies edit and stores the result as one transaction.
+	UpdateSetting(key string, edit func([]byte) ([]byte, error)) error
+
+	AddDownload(record DownloadRecord) error
+	Downloads() ([]DownloadRecord, error)
+
+	AddSession(record SessionRecord) error
+	Sessions() ([]SessionRecord, error)
+}
+
+// DownloadRecord keeps track of an episode downloaded (or queued to be) for offline viewing.
+type DownloadRecord struct {
+	SeriesKey string    `json:"series_key"`
+	Episode   int       `json:"episode"`
+	Url       string    `json:"url"`
+	Path      string    `json:"path"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DefaultStore is used by LoadHistory, SaveHistory and friends. OpenStore replaces it at startup.
+var DefaultStore Store = &JSONStore{}
+
+// OpenStore selects the backend named kind as DefaultStore. An empty kind means bolt.
+// The first time the bolt store is used, an existing history.json is imported into it.
+func OpenStore(kind string) error {
+	switch kind {
+	case StorageJSON:
+		DefaultStore = &JSONStore{}
+		return nil
+	case "", StorageBolt:
+		store := &BoltStore{}
+		if err := store.importJSON(); err != nil {
+			return fmt.Errorf("Failed to import history.json: %w", err)
+		}
+		DefaultStore = store
+		return nil
+	}
+
+	return fmt.Errorf("Unknown storage '%s', use '%s' or '%s'", kind, StorageBolt, StorageJSON)
+}
+
+// statePath returns the path of name inside the data directory, creating the directory if needed.
+func statePath(name string) (string, error) {
+	dataPath, err := paths.Data()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dataPath, name), nil
+}
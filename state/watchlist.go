@@ -0,0 +1,128 @@
+package state
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"hianime-mpv-go/hianime"
+)
+
+// WatchlistEntry is a series saved to watch later. It is kept apart from the library until it is promoted.
+type WatchlistEntry struct {
+	hianime.SeriesData
+	AddedAt time.Time `json:"added_at"`
+}
+
+// Key matches the library key, so a series is the same entry in both.
+func (w WatchlistEntry) Key() string {
+	return NewHistory(w.SeriesData).Key()
+}
+
+func LoadWatchlist() ([]WatchlistEntry, error) {
+	return DefaultStore.LoadWatchlist()
+}
+
+// UpdateWatchlist runs edit on the stored watchlist in a single transaction and saves the result.
+func UpdateWatchlist(edit func([]WatchlistEntry) ([]WatchlistEntry, error)) ([]WatchlistEntry, error) {
+	var updated []WatchlistEntry
+	err := DefaultStore.UpdateWatchlist(func(list []WatchlistEntry) ([]WatchlistEntry, error) {
+		var err error
+		updated, err = edit(list)
+		return updated, err
+	})
+	return updated, err
+}
+
+// FindWatchlistEntry resolves ref, either a series url or a 1-based position, to an index in list.
+func FindWatchlistEntry(list []WatchlistEntry, ref string) (int, error) {
+	if num, err := strconv.Atoi(ref); err == nil {
+		if num < 1 || num > len(list) {
+			return -1, fmt.Errorf("Watchlist number %d is out of range (1-%d)", num, len(list))
+		}
+		return num - 1, nil
+	}
+
+	key := History{Url: ref}.Key()
+	for i := range list {
+		if list[i].Key() == key {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("'%s' isn't in the watchlist", ref)
+}
+
+// AddToWatchlist appends a series to the end of the watchlist.
+func AddToWatchlist(list []WatchlistEntry, metaData hianime.SeriesData) ([]WatchlistEntry, error) {
+	entry := WatchlistEntry{SeriesData: metaData, AddedAt: time.Now()}
+	for i := range list {
+		if list[i].Key() == entry.Key() {
+			return list, fmt.Errorf("%s is already in the watchlist", metaData.JapaneseName)
+		}
+	}
+	return append(list, entry), nil
+}
+
+func RemoveFromWatchlist(list []WatchlistEntry, ref string) ([]WatchlistEntry, error) {
+	i, err := FindWatchlistEntry(list, ref)
+	if err != nil {
+		return list, err
+	}
+	return append(list[:i:i], list[i+1:]...), nil
+}
+
+// MoveInWatchlist moves an entry to the 1-based position to, shifting the others.
+func MoveInWatchlist(list []WatchlistEntry, ref string, to int) ([]WatchlistEntry, error) {
+	i, err := FindWatchlistEntry(list, ref)
+	if err != nil {
+		return list, err
+	}
+	if to < 1 || to > len(list) {
+		return list, fmt.Errorf("Position %d is out of range (1-%d)", to, len(list))
+	}
+
+	entry := list[i]
+	rest := append(list[:i:i], list[i+1:]...)
+	moved := append(rest[:to-1:to-1], entry)
+	return append(moved, rest[to-1:]...), nil
+}
+
+// PromoteFromWatchlist takes a series off the watchlist and puts it at the front of the library as watching.
+// A series already in the library keeps its progress. It returns the entry and the library as they are now stored.
+// The series is added to the library before it leaves the watchlist, so a crash in between can't lose it.
+func PromoteFromWatchlist(ref string) (History, []History, error) {
+	list, err := LoadWatchlist()
+	if err != nil {
+		return History{}, nil, err
+	}
+	i, err := FindWatchlistEntry(list, ref)
+	if err != nil {
+		return History{}, nil, err
+	}
+	entry := list[i]
+
+	var promoted History
+	library, err := UpdateLibrary(func(library []History) ([]History, error) {
+		h, exists := FindHistory(library, entry.SeriesData)
+		if !exists {
+			h = NewHistory(entry.SeriesData)
+		}
+		h.Status = StatusWatching
+		promoted = h
+		return UpdateHistory(library, h), nil
+	})
+	if err != nil {
+		return History{}, nil, err
+	}
+
+	// By key, the positions may have changed since.
+	_, err = UpdateWatchlist(func(list []WatchlistEntry) ([]WatchlistEntry, error) {
+		for i := range list {
+			if list[i].Key() == entry.Key() {
+				return append(list[:i:i], list[i+1:]...), nil
+			}
+		}
+		return list, nil
+	})
+	return promoted, library, err
+}
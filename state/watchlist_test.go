@@ -0,0 +1,47 @@
+package state
+
+import (
+	"testing"
+
+	"hianime-mpv-go/hianime"
+	"hianime-mpv-go/paths"
+)
+
+func TestPromoteFromWatchlist(t *testing.T) {
+	paths.DataDir = t.TempDir()
+	DefaultStore = &JSONStore{}
+	t.Cleanup(func() { paths.DataDir = "" })
+
+	onePiece := hianime.SeriesData{AnimeID: "100", SeriesUrl: "https://hianime.to/one-piece-100", JapaneseName: "One Piece"}
+	naruto := hianime.SeriesData{AnimeID: "677", SeriesUrl: "https://hianime.to/naruto-677", JapaneseName: "Naruto"}
+	_, err := UpdateWatchlist(func(list []WatchlistEntry) ([]WatchlistEntry, error) {
+		list, _ = AddToWatchlist(list, onePiece)
+		return AddToWatchlist(list, naruto)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveHistory([]History{{AnimeID: "677", Url: naruto.SeriesUrl, LastEpisode: 12}}); err != nil {
+		t.Fatal(err)
+	}
+
+	promoted, library, err := PromoteFromWatchlist("2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if promoted.Status != StatusWatching || promoted.LastEpisode != 12 {
+		t.Errorf("got %+v, want Naruto watching with its progress kept", promoted)
+	}
+	if len(library) != 1 || library[0].Key() != promoted.Key() {
+		t.Errorf("library %+v, want only Naruto", library)
+	}
+
+	list, err := LoadWatchlist()
+	if err != nil || len(list) != 1 || list[0].AnimeID != "100" {
+		t.Errorf("watchlist %+v, %v; want only One Piece left", list, err)
+	}
+
+	if _, _, err := PromoteFromWatchlist("https://hianime.to/frieren-18542"); err == nil {
+		t.Error("promoted a series that isn't in the watchlist")
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"hianime-mpv-go/config"
+	"hianime-mpv-go/state"
+	"hianime-mpv-go/stats"
+	"hianime-mpv-go/ui"
+)
+
+func cmdStats(args []string, history []state.History, configSession config.Settings) error {
+	fs := newFlagSet("stats")
+	period := fs.String("period", stats.Day, "Group the totals by day, week or month")
+	limit := fs.Int("limit", 14, "How many of the most recent periods to show")
+	csvTable := fs.String("csv", "", "Write one table as CSV instead: totals or series")
+
+	positional, err := parseInterleaved(fs, args)
+	if err != nil || len(positional) != 0 {
+		return errUsage
+	}
+
+	sessions, err := state.LoadSessions()
+	if err != nil {
+		return err
+	}
+	report, err := stats.Build(history, sessions, *period, time.Now())
+	if err != nil {
+		return err
+	}
+
+	if *csvTable != "" {
+		return report.WriteCSV(stdout, *csvTable)
+	}
+	if ui.Output != ui.OutputText {
+		return ui.PrintRecord("stats", report)
+	}
+	if report.Sessions == 0 && report.EpisodesWatched == 0 {
+		fmt.Println("--! Nothing watched yet")
+		return nil
+	}
+
+	ui.PrintStats(report, *limit)
+	return nil
+}
@@ -0,0 +1,251 @@
+// Package stats sums up the viewing sessions and the library progress into a report of how much is watched.
+package stats
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"time"
+
+	"hianime-mpv-go/state"
+)
+
+// Period lengths the totals can be grouped by.
+const (
+	Day   = "day"
+	Week  = "week"
+	Month = "month"
+)
+
+// Total is what was watched during one period.
+type Total struct {
+	Period   string  `json:"period"` // e.g. 2026-10-19, 2026-W42 or 2026-10
+	Sessions int     `json:"sessions"`
+	Seconds  float64 `json:"seconds"`
+	Episodes int     `json:"episodes"` // episodes watched to the end, rewatches included
+}
+
+// Series is what was watched of one series.
+type Series struct {
+	Key        string  `json:"key"`
+	Name       string  `json:"name"`
+	Sessions   int     `json:"sessions"`
+	Seconds    float64 `json:"seconds"`
+	Watched    int     `json:"watched"`    // episodes flagged as watched
+	Episodes   int     `json:"episodes"`   // episodes known to exist, 0 when never checked
+	Completion float64 `json:"completion"` // Watched out of Episodes, 0 when Episodes is unknown
+}
+
+type Report struct {
+	Sessions        int       `json:"sessions"`
+	Seconds         float64   `json:"seconds"`
+	AverageSession  float64   `json:"average_session"` // seconds
+	EpisodesStarted int       `json:"episodes_started"`
+	EpisodesWatched int       `json:"episodes_watched"`
+	Completion      float64   `json:"completion"`     // EpisodesWatched out of EpisodesStarted
+	LongestStreak   int       `json:"longest_streak"` // most days in a row with something watched
+	StreakStart     time.Time `json:"streak_start,omitzero"`
+	CurrentStreak   int       `json:"current_streak"`
+	Period          string    `json:"period"`
+	Totals          []Total   `json:"totals"` // most recent first
+	Series          []Series  `json:"series"` // most watched first
+}
+
+// Build computes the report of the sessions and the library, with totals grouped by period.
+// now decides whether the current streak is still going.
+func Build(library []state.History, sessions []state.SessionRecord, period string, now time.Time) (Report, error) {
+	report := Report{Period: period}
+
+	switch period {
+	case Day, Week, Month:
+	default:
+		return report, fmt.Errorf("Unknown period '%s', use day, week or month", period)
+	}
+
+	totals := make(map[string]*Total)
+	total := func(t time.Time) *Total {
+		key := PeriodKey(t, period)
+		if totals[key] == nil {
+			totals[key] = &Total{Period: key}
+		}
+		return totals[key]
+	}
+
+	series := make(map[string]*Series)
+	days := make(map[string]bool)
+
+	// Episodes finished during a session are counted by their sessions.
+	finished := make(map[string]bool)
+	for _, rec := range sessions {
+		if rec.Finished {
+			finished[episodeKey(rec.SeriesKey, rec.Episode)] = true
+		}
+	}
+
+	for _, h := range library {
+		s := &Series{Key: h.Key(), Name: h.JapaneseName, Episodes: h.KnownEpisodes}
+		series[s.Key] = s
+
+		for num, prog := range h.Episode {
+			if prog.Position > 0 || prog.Watched {
+				report.EpisodesStarted++
+			}
+			if !prog.Watched {
+				continue
+			}
+			report.EpisodesWatched++
+			s.Watched++
+
+			// Episodes watched before sessions were recorded, or marked by hand, count on the day they were first watched.
+			if !prog.FirstWatchedAt.IsZero() && !finished[episodeKey(s.Key, num)] {
+				total(prog.FirstWatchedAt).Episodes += 1 + prog.Rewatches
+				days[PeriodKey(prog.FirstWatchedAt, Day)] = true
+			}
+		}
+	}
+
+	for _, rec := range sessions {
+		report.Sessions++
+		report.Seconds += rec.Seconds
+
+		t := total(rec.StartedAt)
+		t.Sessions++
+		t.Seconds += rec.Seconds
+		if rec.Finished {
+			t.Episodes++
+		}
+		days[PeriodKey(rec.StartedAt, Day)] = true
+
+		s := series[rec.SeriesKey]
+		if s == nil {
+			// Removed from the library since.
+			s = &Series{Key: rec.SeriesKey, Name: rec.Series}
+			series[rec.SeriesKey] = s
+		}
+		s.Sessions++
+		s.Seconds += rec.Seconds
+	}
+
+	if report.Sessions > 0 {
+		report.AverageSession = report.Seconds / float64(report.Sessions)
+	}
+	if report.EpisodesStarted > 0 {
+		report.Completion = float64(report.EpisodesWatched) / float64(report.EpisodesStarted)
+	}
+	report.LongestStreak, report.StreakStart, report.CurrentStreak = streaks(days, now)
+
+	for _, t := range totals {
+		report.Totals = append(report.Totals, *t)
+	}
+	sort.Slice(report.Totals, func(i, j int) bool { return report.Totals[i].Period > report.Totals[j].Period })
+
+	for _, s := range series {
+		if s.Sessions == 0 && s.Watched == 0 {
+			continue
+		}
+		if s.Episodes > 0 {
+			s.Completion = min(1, float64(s.Watched)/float64(s.Episodes))
+		}
+		report.Series = append(report.Series, *s)
+	}
+	sort.Slice(report.Series, func(i, j int) bool {
+		a, b := report.Series[i], report.Series[j]
+		if a.Seconds != b.Seconds {
+			return a.Seconds > b.Seconds
+		}
+		if a.Watched != b.Watched {
+			return a.Watched > b.Watched
+		}
+		return a.Name < b.Name
+	})
+
+	return report, nil
+}
+
+// PeriodKey names the period t falls in, in local time.
+func PeriodKey(t time.Time, period string) string {
+	t = t.Local()
+	switch period {
+	case Week:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case Month:
+		return t.Format("2006-01")
+	}
+	return t.Format("2006-01-02")
+}
+
+func episodeKey(seriesKey string, num int) string {
+	return fmt.Sprintf("%s#%d", seriesKey, num)
+}
+
+// streaks returns the longest run of consecutive days, the day it started, and the run that ends today or yesterday.
+func streaks(days map[string]bool, now time.Time) (int, time.Time, int) {
+	var sorted []time.Time
+	for day := range days {
+		if t, err := time.ParseInLocation("2006-01-02", day, time.Local); err == nil {
+			sorted = append(sorted, t)
+		}
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Before(sorted[j]) })
+
+	longest, run := 0, 0
+	var longestStart, runStart time.Time
+	for i, day := range sorted {
+		if i > 0 && day.Equal(sorted[i-1].AddDate(0, 0, 1)) {
+			run++
+		} else {
+			run, runStart = 1, day
+		}
+		if run > longest {
+			longest, longestStart = run, runStart
+		}
+	}
+
+	current := 0
+	if len(sorted) > 0 {
+		last := sorted[len(sorted)-1]
+		today, _ := time.ParseInLocation("2006-01-02", PeriodKey(now, Day), time.Local)
+		if last.Equal(today) || last.Equal(today.AddDate(0, 0, -1)) {
+			current = run
+		}
+	}
+	return longest, longestStart, current
+}
+
+// CSV tables the report can be written as.
+const (
+	TableTotals = "totals"
+	TableSeries = "series"
+)
+
+// WriteCSV writes one table of the report, with a header row. Seconds are whole numbers and rates go from 0 to 1.
+func (r Report) WriteCSV(w io.Writer, table string) error {
+	out := csv.NewWriter(w)
+
+	switch table {
+	case TableTotals:
+		out.Write([]string{r.Period, "sessions", "seconds", "episodes"})
+		for _, t := range r.Totals {
+			out.Write([]string{t.Period, strconv.Itoa(t.Sessions), formatSeconds(t.Seconds), strconv.Itoa(t.Episodes)})
+		}
+	case TableSeries:
+		out.Write([]string{"key", "name", "sessions", "seconds", "watched", "episodes", "completion"})
+		for _, s := range r.Series {
+			out.Write([]string{s.Key, s.Name, strconv.Itoa(s.Sessions), formatSeconds(s.Seconds),
+				strconv.Itoa(s.Watched), strconv.Itoa(s.Episodes), strconv.FormatFloat(s.Completion, 'f', 3, 64)})
+		}
+	default:
+		return fmt.Errorf("Unknown table '%s', use %s or %s", table, TableTotals, TableSeries)
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+func formatSeconds(seconds float64) string {
+	return strconv.FormatFloat(math.Round(seconds), 'f', 0, 64)
+}
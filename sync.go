@@ -0,0 +1,96 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"hianime-mpv-go/config"
+	"hianime-mpv-go/paths"
+	"hianime-mpv-go/state"
+	"hianime-mpv-go/syncfolder"
+	"hianime-mpv-go/ui"
+)
+
+var errSyncOff = errors.New(`Syncing is off, set "sync": {"folder": "..."} in the config`)
+
+func cmdSync(args []string, history []state.History, configSession config.Settings) error {
+	positional, err := parseInterleaved(newFlagSet("sync"), args)
+	if err != nil || len(positional) != 0 {
+		return errUsage
+	}
+	if configSession.Sync.Folder == "" {
+		return errSyncOff
+	}
+
+	report, err := runSync(configSession)
+	if err != nil {
+		return err
+	}
+	if ui.Output != ui.OutputText {
+		return ui.PrintRecord("sync", report)
+	}
+
+	fmt.Printf("--> Sent %d and received %d changes", report.Sent, report.Received)
+	if len(report.Devices) > 0 {
+		fmt.Printf(" (devices: %s)", strings.Join(report.Devices, ", "))
+	}
+	fmt.Println()
+	printConflicts(report.Conflicts)
+	return nil
+}
+
+// runSync syncs the history of the profile in use with the sync folder. Every profile has its own directory there.
+func runSync(configSession config.Settings) (syncfolder.Report, error) {
+	profile := paths.Profile
+	if profile == "" {
+		profile = config.DefaultProfile
+	}
+	dir := filepath.Join(configSession.Sync.Folder, profile)
+	return syncfolder.Run(dir, syncfolder.DeviceName(configSession.Sync.Device))
+}
+
+// syncOnStartup merges the changes of the other devices before the history is used, returning it as it is now.
+func syncOnStartup(history []state.History, configSession config.Settings) []state.History {
+	if configSession.Sync.Folder == "" {
+		return history
+	}
+
+	report, err := runSync(configSession)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "--! Failed to sync the history: "+err.Error())
+		return history
+	}
+	if report.Received > 0 {
+		fmt.Fprintf(os.Stderr, "--> Received %d changes from the sync folder\n", report.Received)
+	}
+	printConflicts(report.Conflicts)
+
+	reloaded, err := state.LoadHistory()
+	if err != nil {
+		return history
+	}
+	return reloaded
+}
+
+// syncOnExit writes the changes made during the session to the sync folder.
+func syncOnExit(configSession config.Settings) {
+	if configSession.Sync.Folder == "" {
+		return
+	}
+
+	report, err := runSync(configSession)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "--! Failed to sync the history: "+err.Error())
+		return
+	}
+	printConflicts(report.Conflicts)
+}
+
+func printConflicts(conflicts []syncfolder.Conflict) {
+	for _, c := range conflicts {
+		fmt.Fprintln(os.Stderr, "--! Sync conflict: "+c.String())
+	}
+}
@@ -0,0 +1,218 @@
+package syncfolder
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"hianime-mpv-go/state"
+)
+
+// StateSetting is the store setting holding the versions the library is at and how far the other logs were read.
+const StateSetting = "sync_state"
+
+const logExt = ".jsonl"
+
+type syncState struct {
+	Known   Known            `json:"known"`
+	Offsets map[string]int64 `json:"offsets"`           // bytes of every other device's log already merged
+	Pending []Event          `json:"pending,omitempty"` // changes of this device not written to its log yet
+}
+
+// Report sums up a sync.
+type Report struct {
+	Sent      int        `json:"sent"`     // changes written to the log of this device
+	Received  int        `json:"received"` // changes read from the logs of other devices
+	Devices   []string   `json:"devices"`  // the other devices with a log
+	Conflicts []Conflict `json:"conflicts"`
+}
+
+var unsafeChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+// DeviceName returns the name the log of this device is saved under: name if set, the hostname otherwise.
+func DeviceName(name string) string {
+	if name == "" {
+		name, _ = os.Hostname()
+	}
+	name = strings.Trim(unsafeChars.ReplaceAllString(name, "-"), "-.")
+	if name == "" {
+		return "device"
+	}
+	return name
+}
+
+// Run merges the logs the other devices wrote to dir since the last sync, then appends the changes made to the
+// library since to the log of device. The library and the sync state are saved in one transaction, and the
+// changes are only written to the log once it is committed.
+func Run(dir, device string) (Report, error) {
+	report := Report{Conflicts: []Conflict{}}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return report, fmt.Errorf("Failed to create the sync folder: %w", err)
+	}
+
+	err := state.DefaultStore.UpdateWithSetting(StateSetting, func(library []state.History, raw []byte) ([]state.History, []byte, error) {
+		st, err := decodeState(raw)
+		if err != nil {
+			return nil, nil, err
+		}
+		st.Pending = append(st.Pending, Diff(library, st.Known, device, time.Now().UTC())...)
+
+		remote, devices, err := readLogs(dir, device, st.Offsets)
+		if err != nil {
+			return nil, nil, err
+		}
+		report.Received = len(remote)
+		report.Devices = devices
+
+		var conflicts []Conflict
+		library, conflicts = Merge(library, st.Known, remote)
+		report.Conflicts = append(report.Conflicts, conflicts...)
+
+		raw, err = json.Marshal(st)
+		return library, raw, err
+	})
+	if err != nil {
+		return report, err
+	}
+
+	report.Sent, err = writePending(filepath.Join(dir, device+logExt))
+	return report, err
+}
+
+// writePending appends the pending changes to the log and clears them. They stay pending when the log can't be
+// written, and are written by the next sync.
+func writePending(file string) (int, error) {
+	sent := 0
+	err := state.DefaultStore.UpdateSetting(StateSetting, func(raw []byte) ([]byte, error) {
+		st, err := decodeState(raw)
+		if err != nil {
+			return nil, err
+		}
+		if err := appendLog(file, st.Pending); err != nil {
+			return nil, err
+		}
+		sent = len(st.Pending)
+		st.Pending = nil
+		return json.Marshal(st)
+	})
+	return sent, err
+}
+
+func decodeState(raw []byte) (syncState, error) {
+	st := syncState{Known: make(Known), Offsets: make(map[string]int64)}
+	if len(raw) == 0 {
+		return st, nil
+	}
+
+	if err := json.Unmarshal(raw, &st); err != nil {
+		return st, fmt.Errorf("Failed to decode the sync state: %w", err)
+	}
+	if st.Known == nil {
+		st.Known = make(Known)
+	}
+	if st.Offsets == nil {
+		st.Offsets = make(map[string]int64)
+	}
+	return st, nil
+}
+
+// appendLog adds events to the end of a log, one JSON object per line.
+func appendLog(file string, events []Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, e := range events {
+		if err := enc.Encode(e); err != nil {
+			return fmt.Errorf("Failed to encode a sync event: %w", err)
+		}
+	}
+
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("Failed to open the sync log: %w", err)
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return fmt.Errorf("Failed to write the sync log: %w", err)
+	}
+	return f.Close()
+}
+
+// readLogs returns the events the other devices logged since offsets, device by device, and moves the offsets
+// past them. A last line without a newline is still being synced and is left for next time. A log shorter than
+// its offset was recreated and is read again from the start.
+func readLogs(dir, self string, offsets map[string]int64) ([]Event, []string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+logExt))
+	if err != nil {
+		return nil, nil, err
+	}
+	sort.Strings(files)
+
+	var events []Event
+	var devices []string
+	for _, file := range files {
+		device := strings.TrimSuffix(filepath.Base(file), logExt)
+		if device == self {
+			continue
+		}
+		devices = append(devices, device)
+
+		read, offset, err := readLog(file, offsets[device])
+		if err != nil {
+			return nil, nil, err
+		}
+		events = append(events, read...)
+		offsets[device] = offset
+	}
+	return events, devices, nil
+}
+
+func readLog(file string, offset int64) ([]Event, int64, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, offset, fmt.Errorf("Failed to open the sync log: %w", err)
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, offset, fmt.Errorf("Failed to read the sync log: %w", err)
+	}
+	if info.Size() < offset {
+		offset = 0
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return nil, offset, fmt.Errorf("Failed to read the sync log: %w", err)
+	}
+
+	var events []Event
+	reader := bufio.NewReader(f)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return events, offset, nil
+		}
+		if err != nil {
+			return events, offset, fmt.Errorf("Failed to read the sync log: %w", err)
+		}
+		offset += int64(len(line))
+
+		var e Event
+		if err := json.Unmarshal(line, &e); err != nil {
+			// A line mangled by the file sync is skipped rather than blocking the log for good.
+			continue
+		}
+		events = append(events, e)
+	}
+}
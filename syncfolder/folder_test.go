@@ -0,0 +1,98 @@
+package syncfolder
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"hianime-mpv-go/paths"
+	"hianime-mpv-go/state"
+)
+
+// useDataDir points the store at dir, the data directory of one device.
+func useDataDir(t *testing.T, dir string) {
+	t.Helper()
+	paths.DataDir = dir
+	state.DefaultStore = &state.JSONStore{}
+	t.Cleanup(func() { paths.DataDir = "" })
+}
+
+func logLines(t *testing.T, file string) int {
+	t.Helper()
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	n := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		n++
+	}
+	return n
+}
+
+func TestRunSyncsTwoDevices(t *testing.T) {
+	folder := t.TempDir()
+	laptopDir, desktopDir := t.TempDir(), t.TempDir()
+
+	useDataDir(t, laptopDir)
+	onePiece := series("100", "One Piece", map[int]state.EpisodeProgress{1: progress(300, at(0))})
+	if err := state.SaveHistory([]state.History{onePiece}); err != nil {
+		t.Fatal(err)
+	}
+	report, err := Run(folder, "laptop")
+	if err != nil || report.Sent != 2 {
+		t.Fatalf("Run = %+v, %v; want the series and its episode sent", report, err)
+	}
+
+	useDataDir(t, desktopDir)
+	report, err = Run(folder, "desktop")
+	if err != nil || report.Received != 2 || report.Sent != 0 {
+		t.Fatalf("Run = %+v, %v; want 2 received and nothing sent back", report, err)
+	}
+	library, err := state.LoadHistory()
+	if err != nil || len(library) != 1 || library[0].Episode[1].Position != 300 {
+		t.Fatalf("desktop library %+v, %v; want One Piece at 300", library, err)
+	}
+
+	// Nothing changed since: a second sync reads and writes nothing.
+	if report, err := Run(folder, "desktop"); err != nil || report.Received != 0 || report.Sent != 0 {
+		t.Errorf("Run = %+v, %v; want nothing to do", report, err)
+	}
+}
+
+func TestRunKeepsChangesWhenTheLogFails(t *testing.T) {
+	folder := t.TempDir()
+	useDataDir(t, t.TempDir())
+
+	onePiece := series("100", "One Piece", map[int]state.EpisodeProgress{1: progress(300, at(0))})
+	if err := state.SaveHistory([]state.History{onePiece}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A directory where the log should be makes writing it fail.
+	logFile := filepath.Join(folder, "laptop"+logExt)
+	if err := os.Mkdir(logFile, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Run(folder, "laptop"); err == nil {
+		t.Fatal("Run succeeded without a log to write")
+	}
+
+	if err := os.Remove(logFile); err != nil {
+		t.Fatal(err)
+	}
+	report, err := Run(folder, "laptop")
+	if err != nil || report.Sent != 2 {
+		t.Fatalf("Run = %+v, %v; want the 2 changes kept from the failed sync", report, err)
+	}
+	if _, err := Run(folder, "laptop"); err != nil {
+		t.Fatal(err)
+	}
+	if n := logLines(t, logFile); n != 2 {
+		t.Errorf("log has %d lines, want every change written once", n)
+	}
+}
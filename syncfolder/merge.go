@@ -0,0 +1,300 @@
+// Package syncfolder keeps the history of several machines in step through a shared folder, e.g. one synced by
+// Syncthing or Dropbox. Every device appends the changes it makes to its own log in the folder and merges the
+// logs of the others, keeping the latest change of every episode.
+package syncfolder
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"hianime-mpv-go/state"
+)
+
+// Event kinds.
+const (
+	KindSeries  = "series"  // the fields of a series besides its episodes
+	KindEpisode = "episode" // the progress of an episode
+	KindUnmark  = "unmark"  // an episode that disappeared from the library since the last sync, found by Diff
+)
+
+// Event is one line of a device log.
+type Event struct {
+	Device   string                 `json:"device"`
+	At       time.Time              `json:"at"`
+	Kind     string                 `json:"kind"`
+	Key      string                 `json:"key"` // series key
+	Episode  int                    `json:"episode,omitempty"`
+	Progress *state.EpisodeProgress `json:"progress,omitempty"` // KindEpisode
+	Series   *state.History         `json:"series,omitempty"`   // KindSeries, without the episodes
+	Base     Version                `json:"base,omitzero"`      // version the device changed, zero for a new one
+}
+
+// Version is the last known change of a series or episode, whichever device made it.
+type Version struct {
+	At     time.Time `json:"at"`
+	Device string    `json:"device"`
+	Hash   string    `json:"hash"` // of the value, empty once the episode is unmarked
+}
+
+// newer reports whether v wins over other: the later change wins, ties go to the device name.
+func (v Version) newer(other Version) bool {
+	if !v.At.Equal(other.At) {
+		return v.At.After(other.At)
+	}
+	return v.Device > other.Device
+}
+
+func (v Version) same(other Version) bool {
+	return v.At.Equal(other.At) && v.Device == other.Device && v.Hash == other.Hash
+}
+
+// Conflict is a change two devices made to the same series or episode without seeing each other's.
+// The newer one was kept.
+type Conflict struct {
+	Key       string  `json:"key"`
+	Series    string  `json:"series"`
+	Episode   int     `json:"episode,omitempty"` // 0 for the series fields
+	Kept      Version `json:"kept"`
+	Discarded Version `json:"discarded"`
+}
+
+func (c Conflict) String() string {
+	what := "series settings"
+	if c.Episode > 0 {
+		what = fmt.Sprintf("episode %d", c.Episode)
+	}
+	return fmt.Sprintf("%s %s: kept the change from %s (%s) over %s (%s)", c.Series, what,
+		c.Kept.Device, c.Kept.At.Local().Format("2006-01-02 15:04"),
+		c.Discarded.Device, c.Discarded.At.Local().Format("2006-01-02 15:04"))
+}
+
+// Known maps a series key, or a series key plus episode, to its last known version.
+type Known map[string]Version
+
+func seriesKey(key string) string {
+	return key
+}
+
+func episodeKey(key string, episode int) string {
+	return fmt.Sprintf("%s#%d", key, episode)
+}
+
+func hash(v any) string {
+	data, _ := json.Marshal(v)
+	sum := sha1.Sum(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// seriesFields is the series without its episodes, which are versioned one by one.
+func seriesFields(h state.History) state.History {
+	h.Episode = nil
+	return h
+}
+
+// Diff returns the events for the changes made to library since known was last updated, and updates known.
+// Episodes carry their own time, series fields and unmarked episodes get now.
+func Diff(library []state.History, known Known, device string, now time.Time) []Event {
+	var events []Event
+	seen := make(map[string]bool)
+
+	for _, h := range library {
+		key := h.Key()
+		seen[seriesKey(key)] = true
+
+		fields := seriesFields(h)
+		if sum := hash(fields); known[seriesKey(key)].Hash != sum {
+			base := known[seriesKey(key)]
+			known[seriesKey(key)] = Version{At: now, Device: device, Hash: sum}
+			events = append(events, Event{Device: device, At: now, Kind: KindSeries, Key: key, Series: &fields, Base: base})
+		}
+
+		nums := make([]int, 0, len(h.Episode))
+		for num := range h.Episode {
+			nums = append(nums, num)
+		}
+		sort.Ints(nums)
+
+		for _, num := range nums {
+			prog := h.Episode[num]
+			k := episodeKey(key, num)
+			seen[k] = true
+
+			sum := hash(prog)
+			if known[k].Hash == sum {
+				continue
+			}
+			at := prog.UpdatedAt
+			if at.IsZero() {
+				at = now
+			}
+			base := known[k]
+			known[k] = Version{At: at, Device: device, Hash: sum}
+			events = append(events, Event{Device: device, At: at, Kind: KindEpisode, Key: key, Episode: num, Progress: &prog, Base: base})
+		}
+	}
+
+	// Episodes known before but gone now were unmarked. Series are never removed from the library.
+	var gone []string
+	for k, v := range known {
+		if !seen[k] && v.Hash != "" && isEpisodeKey(k) {
+			gone = append(gone, k)
+		}
+	}
+	sort.Strings(gone)
+	for _, k := range gone {
+		key, num := splitEpisodeKey(k)
+		base := known[k]
+		known[k] = Version{At: now, Device: device}
+		events = append(events, Event{Device: device, At: now, Kind: KindUnmark, Key: key, Episode: num, Base: base})
+	}
+
+	return events
+}
+
+func isEpisodeKey(k string) bool {
+	_, num := splitEpisodeKey(k)
+	return num > 0
+}
+
+func splitEpisodeKey(k string) (string, int) {
+	for i := len(k) - 1; i >= 0; i-- {
+		if k[i] == '#' {
+			num := 0
+			if _, err := fmt.Sscanf(k[i+1:], "%d", &num); err != nil {
+				return k, 0
+			}
+			return k[:i], num
+		}
+	}
+	return k, 0
+}
+
+// Merge applies the events of other devices to library, keeping the latest change of every series and episode.
+// Series events are applied first, so the episodes of a new series find it whatever order the logs are read in.
+// known holds the versions the library is at and is updated. Two devices changing the same thing without having seen each
+// other's change is reported as a conflict. Series that got newer progress than anything in the library move
+// to the front, in order, so 'continue' picks up what was watched last on any device.
+func Merge(library []state.History, known Known, events []Event) ([]state.History, []Conflict) {
+	index := make(map[string]int, len(library))
+	latest := time.Time{}
+	for i, h := range library {
+		index[h.Key()] = i
+		for _, prog := range h.Episode {
+			if prog.UpdatedAt.After(latest) {
+				latest = prog.UpdatedAt
+			}
+		}
+	}
+
+	var conflicts []Conflict
+	recent := make(map[string]time.Time)
+
+	events = slices.Clone(events)
+	sort.SliceStable(events, func(a, b int) bool {
+		return events[a].Kind == KindSeries && events[b].Kind != KindSeries
+	})
+
+	for _, e := range events {
+		k := seriesKey(e.Key)
+		var sum string
+		switch e.Kind {
+		case KindSeries:
+			if e.Series == nil {
+				continue
+			}
+			sum = hash(seriesFields(*e.Series))
+		case KindEpisode:
+			if e.Progress == nil {
+				continue
+			}
+			k = episodeKey(e.Key, e.Episode)
+			sum = hash(*e.Progress)
+		case KindUnmark:
+			k = episodeKey(e.Key, e.Episode)
+		default:
+			continue
+		}
+
+		i, inLibrary := index[e.Key]
+		if !inLibrary && e.Kind != KindSeries {
+			continue
+		}
+
+		incoming := Version{At: e.At, Device: e.Device, Hash: sum}
+		current, exists := known[k]
+		if exists && current.Hash == incoming.Hash {
+			// Same value, e.g. both devices imported the same progress.
+			if incoming.newer(current) {
+				known[k] = incoming
+			}
+			continue
+		}
+
+		// The device changed something else than what this one has: both changed it independently.
+		if exists && current.Device != e.Device && !e.Base.same(current) {
+			name := e.Key
+			if inLibrary {
+				name = library[i].JapaneseName
+			} else if e.Series != nil {
+				name = e.Series.JapaneseName
+			}
+			conflict := Conflict{Key: e.Key, Series: name, Episode: e.Episode, Kept: incoming, Discarded: current}
+			if !incoming.newer(current) {
+				conflict.Kept, conflict.Discarded = current, incoming
+			}
+			conflicts = append(conflicts, conflict)
+		}
+		if exists && !incoming.newer(current) {
+			continue
+		}
+		known[k] = incoming
+
+		if !inLibrary {
+			index[e.Key] = len(library)
+			i = len(library)
+			library = append(library, state.History{})
+		}
+
+		h := &library[i]
+		switch e.Kind {
+		case KindSeries:
+			episodes := h.Episode
+			*h = seriesFields(*e.Series)
+			h.Episode = episodes
+		case KindEpisode:
+			if h.Episode == nil {
+				h.Episode = make(map[int]state.EpisodeProgress)
+			}
+			h.Episode[e.Episode] = *e.Progress
+			if e.At.After(latest) && e.At.After(recent[e.Key]) {
+				recent[e.Key] = e.At
+			}
+		case KindUnmark:
+			delete(h.Episode, e.Episode)
+		}
+	}
+
+	// Oldest first, so the newest ends up in front.
+	keys := make([]string, 0, len(recent))
+	for key := range recent {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(a, b int) bool { return recent[keys[a]].Before(recent[keys[b]]) })
+	for _, key := range keys {
+		for i := range library {
+			if library[i].Key() == key {
+				archived := library[i].Archived
+				library = state.UpdateHistory(library, library[i])
+				library[0].Archived = archived
+				break
+			}
+		}
+	}
+
+	return library, conflicts
+}
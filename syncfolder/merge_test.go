@@ -0,0 +1,247 @@
+package syncfolder
+
+import (
+	"testing"
+	"time"
+
+	"hianime-mpv-go/state"
+)
+
+var base = time.Date(2025, 3, 1, 20, 0, 0, 0, time.UTC)
+
+func at(minutes int) time.Time {
+	return base.Add(time.Duration(minutes) * time.Minute)
+}
+
+func series(id, name string, episodes map[int]state.EpisodeProgress) state.History {
+	if episodes == nil {
+		episodes = make(map[int]state.EpisodeProgress)
+	}
+	return state.History{
+		Provider:     state.ProviderHianime,
+		AnimeID:      id,
+		Url:          "https://hianime.to/series-" + id,
+		JapaneseName: name,
+		Episode:      episodes,
+	}
+}
+
+func progress(position float64, updated time.Time) state.EpisodeProgress {
+	return state.EpisodeProgress{Position: position, Duration: 1400, UpdatedAt: updated}
+}
+
+// device is one machine: its library and what it knows of the versions.
+type device struct {
+	name    string
+	library []state.History
+	known   Known
+}
+
+func newDevice(name string, library ...state.History) *device {
+	return &device{name: name, library: library, known: make(Known)}
+}
+
+// diff returns the events of the changes the device made since its last diff.
+func (d *device) diff(now time.Time) []Event {
+	return Diff(d.library, d.known, d.name, now)
+}
+
+func (d *device) merge(events ...[]Event) []Conflict {
+	var all []Event
+	for _, e := range events {
+		all = append(all, e...)
+	}
+	var conflicts []Conflict
+	d.library, conflicts = Merge(d.library, d.known, all)
+	return conflicts
+}
+
+func (d *device) episode(t *testing.T, key string, num int) (state.EpisodeProgress, bool) {
+	t.Helper()
+	for _, h := range d.library {
+		if h.Key() == key {
+			prog, ok := h.Episode[num]
+			return prog, ok
+		}
+	}
+	t.Fatalf("%s: series %s not in the library", d.name, key)
+	return state.EpisodeProgress{}, false
+}
+
+func TestMergeLastWriterWinsPerEpisode(t *testing.T) {
+	onePiece := series("100", "One Piece", map[int]state.EpisodeProgress{1: progress(100, at(0))})
+	key := onePiece.Key()
+
+	laptop := newDevice("laptop", onePiece)
+	desktop := newDevice("desktop")
+	initial := laptop.diff(at(1))
+	desktop.merge(initial)
+
+	// Both play on from the shared version: the laptop episode 1 and 2, the desktop episode 1 later.
+	laptop.library[0].Episode[1] = progress(300, at(10))
+	laptop.library[0].Episode[2] = progress(50, at(11))
+	desktop.library[0].Episode[1] = progress(600, at(20))
+	fromLaptop, fromDesktop := laptop.diff(at(12)), desktop.diff(at(21))
+
+	// A third device gets the same result whichever log it reads first.
+	for _, order := range [][2][]Event{{fromLaptop, fromDesktop}, {fromDesktop, fromLaptop}} {
+		phone := newDevice("phone")
+		phone.merge(initial, order[0], order[1])
+
+		if prog, _ := phone.episode(t, key, 1); prog.Position != 600 {
+			t.Errorf("episode 1 at %v, want the latest change 600", prog.Position)
+		}
+		if prog, ok := phone.episode(t, key, 2); !ok || prog.Position != 50 {
+			t.Errorf("episode 2 = %+v, %v; want the laptop's progress", prog, ok)
+		}
+	}
+}
+
+func TestMergeReportsConflicts(t *testing.T) {
+	onePiece := series("100", "One Piece", map[int]state.EpisodeProgress{1: progress(100, at(0))})
+	key := onePiece.Key()
+
+	laptop := newDevice("laptop", onePiece)
+	desktop := newDevice("desktop")
+	desktop.merge(laptop.diff(at(1)))
+
+	// A change made on top of the laptop's version is no conflict.
+	desktop.library[0].Episode[1] = progress(200, at(5))
+	if conflicts := laptop.merge(desktop.diff(at(6))); len(conflicts) != 0 {
+		t.Fatalf("got %v for a sequential change, want none", conflicts)
+	}
+	if prog, _ := laptop.episode(t, key, 1); prog.Position != 200 {
+		t.Fatalf("episode 1 at %v, want 200", prog.Position)
+	}
+	laptop.diff(at(7))
+
+	// Both change episode 1 without seeing each other's change.
+	laptop.library[0].Episode[1] = progress(700, at(10))
+	desktop.library[0].Episode[1] = progress(900, at(20))
+	fromLaptop, fromDesktop := laptop.diff(at(11)), desktop.diff(at(21))
+
+	conflicts := laptop.merge(fromDesktop)
+	if len(conflicts) != 1 {
+		t.Fatalf("got %v, want one conflict", conflicts)
+	}
+	c := conflicts[0]
+	if c.Key != key || c.Episode != 1 || c.Series != "One Piece" || c.Kept.Device != "desktop" || c.Discarded.Device != "laptop" {
+		t.Errorf("got %+v, want the desktop's newer change kept over the laptop's", c)
+	}
+	if prog, _ := laptop.episode(t, key, 1); prog.Position != 900 {
+		t.Errorf("episode 1 at %v, want the newer 900", prog.Position)
+	}
+
+	// The other side sees the conflict too, and keeps its own newer change.
+	conflicts = desktop.merge(fromLaptop)
+	if len(conflicts) != 1 || conflicts[0].Kept.Device != "desktop" {
+		t.Errorf("got %v, want one conflict kept by the desktop", conflicts)
+	}
+	if prog, _ := desktop.episode(t, key, 1); prog.Position != 900 {
+		t.Errorf("episode 1 at %v on the desktop, want 900", prog.Position)
+	}
+}
+
+func TestMergePropagatesUnmark(t *testing.T) {
+	watched := progress(1350, at(0))
+	watched.Watched = true
+	watched.FirstWatchedAt = at(0)
+	onePiece := series("100", "One Piece", map[int]state.EpisodeProgress{1: watched, 2: watched})
+	key := onePiece.Key()
+
+	laptop := newDevice("laptop", onePiece)
+	desktop := newDevice("desktop")
+	desktop.merge(laptop.diff(at(1)))
+
+	laptop.library[0].UnmarkWatched(1, at(10))
+	desktop.merge(laptop.diff(at(11)))
+
+	prog, ok := desktop.episode(t, key, 1)
+	if !ok || prog.Watched || prog.Position != 1350 {
+		t.Errorf("episode 1 = %+v, %v; want unmarked with its position", prog, ok)
+	}
+	if prog, _ := desktop.episode(t, key, 2); !prog.Watched {
+		t.Error("episode 2 lost its watched flag")
+	}
+
+	// An episode gone from the library is sent as an unmark event and removed on the other side.
+	delete(laptop.library[0].Episode, 2)
+	events := laptop.diff(at(12))
+	if len(events) != 1 || events[0].Kind != KindUnmark {
+		t.Fatalf("got %+v, want one unmark event", events)
+	}
+	desktop.merge(events)
+	if _, ok := desktop.episode(t, key, 2); ok {
+		t.Error("episode 2 is still on the desktop")
+	}
+}
+
+func TestMergeSeriesAfterItsEpisodes(t *testing.T) {
+	onePiece := series("100", "One Piece", map[int]state.EpisodeProgress{1: progress(300, at(0)), 2: progress(60, at(2))})
+	key := onePiece.Key()
+
+	laptop := newDevice("laptop", onePiece)
+	events := laptop.diff(at(3))
+	if len(events) != 3 || events[0].Kind != KindSeries {
+		t.Fatalf("got %+v, want the series then two episodes", events)
+	}
+	reversed := []Event{events[2], events[1], events[0]}
+
+	desktop := newDevice("desktop")
+	desktop.merge(reversed)
+
+	if len(desktop.library) != 1 || desktop.library[0].JapaneseName != "One Piece" {
+		t.Fatalf("library %+v, want One Piece", desktop.library)
+	}
+	for num, want := range map[int]float64{1: 300, 2: 60} {
+		if prog, ok := desktop.episode(t, key, num); !ok || prog.Position != want {
+			t.Errorf("episode %d = %+v, %v; want position %v", num, prog, ok, want)
+		}
+	}
+}
+
+func TestMergeMovesNewestProgressToFront(t *testing.T) {
+	onePiece := series("100", "One Piece", map[int]state.EpisodeProgress{1: progress(300, at(0))})
+	naruto := series("200", "Naruto", map[int]state.EpisodeProgress{1: progress(300, at(1))})
+	frieren := series("300", "Frieren", map[int]state.EpisodeProgress{1: progress(300, at(2))})
+
+	// Most recent first, like the library.
+	laptop := newDevice("laptop", frieren, naruto, onePiece)
+	desktop := newDevice("desktop")
+	desktop.merge(laptop.diff(at(3)))
+	if got := names(desktop.library); got != "Frieren,Naruto,One Piece" {
+		t.Fatalf("library order %s, want the laptop's", got)
+	}
+
+	// The laptop watches One Piece then Naruto, the newest goes in front and archived series stay archived.
+	laptop.library[2].Episode[2] = progress(100, at(10))
+	laptop.library[1].Episode[2] = progress(100, at(20))
+	desktop.library[2].Archived = true
+	desktop.diff(at(4))
+	desktop.merge(laptop.diff(at(21)))
+
+	if got := names(desktop.library); got != "Naruto,One Piece,Frieren" {
+		t.Errorf("library order %s, want Naruto,One Piece,Frieren", got)
+	}
+	if !desktop.library[1].Archived {
+		t.Error("One Piece came out of the archive")
+	}
+
+	// Progress older than what the library has doesn't reorder it.
+	laptop.library[0].Episode[3] = progress(100, at(5))
+	desktop.merge(laptop.diff(at(22)))
+	if got := names(desktop.library); got != "Naruto,One Piece,Frieren" {
+		t.Errorf("library order %s after older progress, want it unchanged", got)
+	}
+}
+
+func names(library []state.History) string {
+	var s string
+	for i, h := range library {
+		if i > 0 {
+			s += ","
+		}
+		s += h.JapaneseName
+	}
+	return s
+}
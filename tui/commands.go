@@ -0,0 +1,138 @@
+package tui
+
+import (
+	"fmt"
+	"io"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"hianime-mpv-go/anilist"
+	"hianime-mpv-go/config"
+	"hianime-mpv-go/hianime"
+	"hianime-mpv-go/player"
+	"hianime-mpv-go/state"
+	"hianime-mpv-go/updates"
+)
+
+// The scrapers block on the network, so every call into hianime runs as a tea.Cmd and reports back with one of these messages.
+
+type searchDoneMsg struct {
+	results []hianime.SearchElements
+	err     error
+}
+
+type seriesLoadedMsg struct {
+	metaData hianime.SeriesData
+	history  state.History
+	episodes []hianime.Episodes
+	saveErr  error // the episode list couldn't be stored, the series still loaded
+	err      error
+}
+
+type serversLoadedMsg struct {
+	episode hianime.Episodes
+	servers []hianime.ServerList
+}
+
+type checkDoneMsg struct {
+	results []updates.Result
+	err     error
+}
+
+type anilistDoneMsg struct {
+	err error
+}
+
+type playbackDoneMsg struct {
+	episode hianime.Episodes
+	result  player.Result
+	err     error
+}
+
+func searchCmd(query string) tea.Cmd {
+	return func() tea.Msg {
+		results, err := hianime.Search(query)
+		return searchDoneMsg{results: results, err: err}
+	}
+}
+
+// loadSeriesCmd fetches the series metadata and its episode list, and finds the series in the library.
+// Episodes already fetched in this session are reused.
+func loadSeriesCmd(url string, library []state.History, cache map[string][]hianime.Episodes) tea.Cmd {
+	return func() tea.Msg {
+		metaData, err := hianime.FetchSeriesData(url)
+		if err != nil {
+			return seriesLoadedMsg{err: fmt.Errorf("Failed to load the series: %w", err)}
+		}
+
+		var saveErr error
+		episodes, exists := cache[metaData.AnimeID]
+		if !exists {
+			episodes, err = hianime.FetchEpisodes(metaData.AnimeID)
+			if err != nil {
+				return seriesLoadedMsg{err: fmt.Errorf("Failed to load the episodes: %w", err)}
+			}
+			if err := state.DefaultStore.SaveEpisodes(metaData.AnimeID, episodes); err != nil {
+				saveErr = fmt.Errorf("Failed to store episode list: %w", err)
+			}
+		}
+
+		history, exists := state.FindHistory(library, metaData)
+		if !exists {
+			history = state.NewHistory(metaData)
+		}
+
+		return seriesLoadedMsg{metaData: metaData, history: history, episodes: episodes, saveErr: saveErr}
+	}
+}
+
+// checkCmd looks for new episodes of the series being watched, for check_on_startup.
+func checkCmd(library []state.History) tea.Cmd {
+	return func() tea.Msg {
+		results := updates.Check(updates.Followed(library), updates.DefaultWorkers, hianime.FetchEpisodes)
+		_, err := updates.Record(results)
+		return checkDoneMsg{results: results, err: err}
+	}
+}
+
+func trackCmd(history state.History, episodeNum int) tea.Cmd {
+	return func() tea.Msg {
+		return anilistDoneMsg{err: anilist.Track(history, episodeNum)}
+	}
+}
+
+func loadServersCmd(episode hianime.Episodes) tea.Cmd {
+	return func() tea.Msg {
+		return serversLoadedMsg{episode: episode, servers: hianime.GetEpisodeServerId(episode.Id)}
+	}
+}
+
+// playback runs mpv while the TUI has released the terminal, so the extractor and mpv logs stay readable.
+type playback struct {
+	servers  []hianime.ServerList
+	metaData hianime.SeriesData
+	episode  hianime.Episodes
+	history  state.History
+	config   config.Settings
+
+	result player.Result
+}
+
+func (p *playback) Run() error {
+	fmt.Printf("\n--- %s [Ep. %d] ---\n\n", p.metaData.JapaneseName, p.episode.Number)
+
+	result, err := player.PlayServers(p.servers, p.metaData, p.episode, p.history, p.config)
+	p.result = result
+
+	return err
+}
+
+func (p *playback) SetStdin(io.Reader)  {}
+func (p *playback) SetStdout(io.Writer) {}
+func (p *playback) SetStderr(io.Writer) {}
+
+func playCmd(p *playback) tea.Cmd {
+	return tea.Exec(p, func(err error) tea.Msg {
+		return playbackDoneMsg{episode: p.episode, result: p.result, err: err}
+	})
+}
@@ -0,0 +1,146 @@
+package tui
+
+import (
+	"fmt"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/progress"
+
+	"hianime-mpv-go/hianime"
+	"hianime-mpv-go/state"
+	"hianime-mpv-go/ui"
+)
+
+// Every pane is a bubbles list, so each row type only has to describe how it is titled and filtered.
+
+type historyItem struct {
+	history state.History
+}
+
+func (i historyItem) Title() string { return i.history.JapaneseName }
+func (i historyItem) Description() string {
+	return fmt.Sprintf("%s · last ep %d", i.history.EnglishName, i.history.LastEpisode)
+}
+func (i historyItem) FilterValue() string {
+	return i.history.JapaneseName + " " + i.history.EnglishName
+}
+
+type watchlistItem struct {
+	entry state.WatchlistEntry
+}
+
+func (i watchlistItem) Title() string { return i.entry.JapaneseName }
+func (i watchlistItem) Description() string {
+	return fmt.Sprintf("%s · added %s", i.entry.EnglishName, i.entry.AddedAt.Format("2006-01-02"))
+}
+func (i watchlistItem) FilterValue() string {
+	return i.entry.JapaneseName + " " + i.entry.EnglishName
+}
+
+type searchItem struct {
+	series hianime.SearchElements
+}
+
+func (i searchItem) Title() string { return i.series.JapaneseName }
+func (i searchItem) Description() string {
+	numEps := i.series.NumberEpisodes
+	if numEps == 0 {
+		numEps = 1
+	}
+	return fmt.Sprintf("%s · %s · %d eps", i.series.Type, i.series.Duration, numEps)
+}
+func (i searchItem) FilterValue() string { return i.series.JapaneseName + " " + i.series.EnglishName }
+
+type episodeItem struct {
+	episode  hianime.Episodes
+	progress state.EpisodeProgress
+	current  bool
+	bar      *progress.Model
+}
+
+func (i episodeItem) Title() string {
+	title := i.episode.JapaneseTitle
+	if title == "" {
+		title = i.episode.EnglishTitle
+	}
+
+	prefix := "  "
+	if i.current {
+		prefix = "->"
+	}
+	return fmt.Sprintf("%s [%02d] %s", prefix, i.episode.Number, title)
+}
+
+func (i episodeItem) Description() string {
+	if i.progress.Watched {
+		return "   " + ui.WatchedInfo(i.progress) + " watched"
+	}
+	if !i.progress.Partial() || i.progress.Duration <= 0 {
+		return "   not watched"
+	}
+
+	percent := i.progress.Position / i.progress.Duration
+	return fmt.Sprintf("   %s %s/%s", i.bar.ViewAs(percent), ui.PrettyDuration(i.progress.Position), ui.PrettyDuration(i.progress.Duration))
+}
+
+func (i episodeItem) FilterValue() string {
+	return fmt.Sprintf("%d %s %s", i.episode.Number, i.episode.EnglishTitle, i.episode.JapaneseTitle)
+}
+
+type serverItem struct {
+	server hianime.ServerList
+}
+
+func (i serverItem) Title() string {
+	if i.server.Type == "dub" {
+		return i.server.Name + " (Dub)"
+	}
+	return i.server.Name
+}
+func (i serverItem) Description() string { return i.server.Type }
+func (i serverItem) FilterValue() string { return i.server.Name + " " + i.server.Type }
+
+func historyItems(history []state.History) []list.Item {
+	items := make([]list.Item, 0, len(history))
+	for _, h := range history {
+		items = append(items, historyItem{history: h})
+	}
+	return items
+}
+
+func watchlistItems(watchlist []state.WatchlistEntry) []list.Item {
+	items := make([]list.Item, 0, len(watchlist))
+	for _, w := range watchlist {
+		items = append(items, watchlistItem{entry: w})
+	}
+	return items
+}
+
+func searchItems(results []hianime.SearchElements) []list.Item {
+	items := make([]list.Item, 0, len(results))
+	for _, r := range results {
+		items = append(items, searchItem{series: r})
+	}
+	return items
+}
+
+func episodeItems(episodes []hianime.Episodes, history state.History, bar *progress.Model) []list.Item {
+	items := make([]list.Item, 0, len(episodes))
+	for _, eps := range episodes {
+		items = append(items, episodeItem{
+			episode:  eps,
+			progress: history.Episode[eps.Number],
+			current:  eps.Number == history.LastEpisode,
+			bar:      bar,
+		})
+	}
+	return items
+}
+
+func serverItems(servers []hianime.ServerList) []list.Item {
+	items := make([]list.Item, 0, len(servers))
+	for _, s := range servers {
+		items = append(items, serverItem{server: s})
+	}
+	return items
+}
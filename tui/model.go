@@ -0,0 +1,544 @@
+package tui
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/list"
+	"github.com/charmbracelet/bubbles/progress"
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textinput"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"hianime-mpv-go/config"
+	"hianime-mpv-go/hianime"
+	"hianime-mpv-go/player"
+	"hianime-mpv-go/state"
+	"hianime-mpv-go/ui"
+	"hianime-mpv-go/updates"
+)
+
+type pane int
+
+const (
+	paneHistory pane = iota
+	paneWatchlist
+	paneSearch
+	paneEpisodes
+	paneServers
+	paneCount
+)
+
+var (
+	borderStyle  = lipgloss.NewStyle().Border(lipgloss.RoundedBorder()).BorderForeground(lipgloss.Color("240"))
+	focusedStyle = borderStyle.BorderForeground(lipgloss.Color("205"))
+	statusStyle  = lipgloss.NewStyle().Foreground(lipgloss.Color("241"))
+	errorStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("196"))
+)
+
+// Model is the whole TUI state: five list panes, a search prompt and the series currently opened.
+type Model struct {
+	panes   [paneCount]list.Model
+	focus   pane
+	search  textinput.Model
+	spinner spinner.Model
+	bar     progress.Model
+
+	searching bool
+	loading   string
+	status    string
+	err       error
+
+	width  int
+	height int
+
+	config    config.Settings
+	history   []state.History
+	watchlist []state.WatchlistEntry
+	episodes  map[string][]hianime.Episodes // "AnimeID" : {{Eps: 1, ...}, ...}
+
+	metaData       hianime.SeriesData
+	historySelect  state.History
+	currentEpisode hianime.Episodes
+}
+
+func newPane(title string, items []list.Item) list.Model {
+	l := list.New(items, list.NewDefaultDelegate(), 0, 0)
+	l.Title = title
+	l.SetShowHelp(false)
+	l.DisableQuitKeybindings()
+	return l
+}
+
+func New(history []state.History, configSession config.Settings) Model {
+	search := textinput.New()
+	search.Placeholder = "anime name"
+	search.Prompt = "Search: "
+
+	sp := spinner.New()
+	sp.Spinner = spinner.Dot
+
+	m := Model{
+		search:   search,
+		spinner:  sp,
+		bar:      progress.New(progress.WithDefaultGradient(), progress.WithWidth(20), progress.WithoutPercentage()),
+		config:   configSession,
+		history:  history,
+		episodes: make(map[string][]hianime.Episodes),
+	}
+
+	m.panes[paneHistory] = newPane("Recent History", historyItems(state.Recent(history, state.RecentLimit)))
+	m.panes[paneWatchlist] = newPane("Watchlist", nil)
+	m.panes[paneSearch] = newPane("Search Results", nil)
+	m.panes[paneEpisodes] = newPane("Episodes", nil)
+	m.panes[paneServers] = newPane("Servers", nil)
+
+	watchlist, err := state.LoadWatchlist()
+	m.err = err
+	m.setWatchlist(watchlist)
+
+	if len(history) == 0 {
+		m.focus = paneSearch
+		m.searching = true
+		m.search.Focus()
+	}
+
+	return m
+}
+
+// Run starts the TUI in the alternate screen and blocks until the user quits.
+func Run(history []state.History, configSession config.Settings) error {
+	_, err := tea.NewProgram(New(history, configSession), tea.WithAltScreen()).Run()
+	return err
+}
+
+func (m Model) Init() tea.Cmd {
+	cmds := []tea.Cmd{textinput.Blink, m.spinner.Tick}
+	if m.config.CheckOnStartup && len(m.history) > 0 {
+		cmds = append(cmds, checkCmd(m.history))
+	}
+	return tea.Batch(cmds...)
+}
+
+func (m *Model) startLoading(label string) {
+	m.loading = label
+	m.status = ""
+	m.err = nil
+}
+
+func (m *Model) saveHistory() {
+	updated, err := state.SaveSeries(m.historySelect)
+	if err != nil {
+		m.err = err
+		updated = state.UpdateHistory(m.history, m.historySelect)
+	}
+	m.history = updated
+	m.panes[paneHistory].SetItems(historyItems(state.Recent(m.history, state.RecentLimit)))
+}
+
+func (m *Model) setWatchlist(watchlist []state.WatchlistEntry) {
+	m.watchlist = watchlist
+	m.panes[paneWatchlist].SetItems(watchlistItems(watchlist))
+}
+
+// editWatchlist saves a change to the watchlist. The store is local, so it runs right away instead of as a tea.Cmd.
+func (m *Model) editWatchlist(edit func([]state.WatchlistEntry) ([]state.WatchlistEntry, error)) bool {
+	updated, err := state.UpdateWatchlist(edit)
+	if err != nil {
+		m.err = err
+		return false
+	}
+	m.setWatchlist(updated)
+	return true
+}
+
+func (m *Model) refreshEpisodes() {
+	episodes := m.episodes[m.metaData.AnimeID]
+	m.panes[paneEpisodes].SetItems(episodeItems(episodes, m.historySelect, &m.bar))
+}
+
+func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.resize()
+		return m, nil
+
+	case spinner.TickMsg:
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+
+	case searchDoneMsg:
+		m.loading = ""
+		if msg.err != nil {
+			m.err = msg.err
+			return m, nil
+		}
+		if len(msg.results) == 0 {
+			m.status = "No anime result found"
+			return m, nil
+		}
+		m.panes[paneSearch].SetItems(searchItems(msg.results))
+		m.panes[paneSearch].ResetSelected()
+		m.focus = paneSearch
+		return m, nil
+
+	case seriesLoadedMsg:
+		m.loading = ""
+		if msg.err != nil {
+			m.err = msg.err
+			return m, nil
+		}
+		m.err = msg.saveErr
+		m.metaData = msg.metaData
+		m.historySelect = msg.history
+		m.episodes[msg.metaData.AnimeID] = msg.episodes
+		m.saveHistory()
+
+		m.panes[paneEpisodes].Title = fmt.Sprintf("Series: %s", msg.metaData.JapaneseName)
+		m.panes[paneServers].SetItems(nil)
+		m.refreshEpisodes()
+		if m.historySelect.LastEpisode > 0 && m.historySelect.LastEpisode <= len(msg.episodes) {
+			m.panes[paneEpisodes].Select(m.historySelect.LastEpisode - 1)
+		}
+		m.focus = paneEpisodes
+		return m, nil
+
+	case serversLoadedMsg:
+		m.loading = ""
+		if len(msg.servers) == 0 {
+			m.status = "No available servers found."
+			return m, nil
+		}
+		servers := player.OrderServers(msg.servers, m.config, m.historySelect)
+		m.panes[paneServers].SetItems(serverItems(servers))
+		m.panes[paneServers].ResetSelected()
+
+		if m.config.AutoSelectServer {
+			return m, m.play(servers, "")
+		}
+		m.focus = paneServers
+		if m.historySelect.Episode[msg.episode.Number].Partial() {
+			m.status = "enter resumes, 0 starts over, i starts after the intro"
+		}
+		return m, nil
+
+	case checkDoneMsg:
+		if msg.err != nil {
+			m.err = msg.err
+		}
+		// Only the counts are taken, the library may have changed while the check ran.
+		for _, r := range msg.results {
+			for i := range m.history {
+				if r.Err == nil && m.history[i].Key() == r.Series.Key() {
+					m.history[i].KnownEpisodes = r.Total
+				}
+			}
+		}
+
+		var found []string
+		for _, r := range updates.WithNew(msg.results) {
+			found = append(found, fmt.Sprintf("%s (+%d)", r.Series.JapaneseName, len(r.Episodes)))
+		}
+		if len(found) > 0 && m.loading == "" {
+			m.status = "New episodes: " + strings.Join(found, ", ")
+		}
+		return m, nil
+
+	case playbackDoneMsg:
+		m.loading = ""
+		if msg.err != nil {
+			m.err = msg.err
+			return m, nil
+		}
+		m.historySelect.RecordProgress(msg.episode.Number, msg.result.Position, msg.result.Duration, msg.result.OutroStart, msg.result.SubDelay, msg.result.Volume)
+		m.saveHistory()
+		if err := state.AddSession(msg.result.Session(m.historySelect, msg.episode.Number)); err != nil {
+			m.err = err
+		}
+		m.refreshEpisodes()
+		m.status = fmt.Sprintf("Stopped episode %d at %s on %s", msg.episode.Number, ui.PrettyDuration(msg.result.Position), msg.result.Server.Name)
+		m.focus = paneEpisodes
+		return m, trackCmd(m.historySelect, msg.episode.Number)
+
+	case anilistDoneMsg:
+		if msg.err != nil {
+			m.err = fmt.Errorf("AniList sync failed: %w", msg.err)
+		}
+		return m, nil
+
+	case tea.KeyMsg:
+		if msg.String() == "ctrl+c" {
+			return m, tea.Quit
+		}
+		if m.searching {
+			return m.updateSearch(msg)
+		}
+		if m.panes[m.focus].SettingFilter() {
+			break
+		}
+		if m.loading != "" && msg.String() != "q" {
+			return m, nil
+		}
+
+		switch msg.String() {
+		case "q":
+			return m, tea.Quit
+		case "tab":
+			m.focus = (m.focus + 1) % paneCount
+			return m, nil
+		case "shift+tab":
+			m.focus = (m.focus + paneCount - 1) % paneCount
+			return m, nil
+		case "s":
+			m.searching = true
+			m.search.SetValue("")
+			return m, m.search.Focus()
+		case "esc":
+			if !m.panes[m.focus].IsFiltered() {
+				m.back()
+				return m, nil
+			}
+		case "enter":
+			return m.selectItem()
+		case "w", "d", "K", "J":
+			if m.watchlistKey(msg.String()) {
+				return m, nil
+			}
+		case "0", "i":
+			// Start the episode over, or after the intro, instead of resuming it.
+			if item, ok := m.panes[m.focus].SelectedItem().(serverItem); ok {
+				resume := player.ResumeRestart
+				if msg.String() == "i" {
+					resume = player.ResumeIntro
+				}
+				m.pickServer(item.server)
+				return m, m.play([]hianime.ServerList{item.server}, resume)
+			}
+		}
+	}
+
+	var cmd tea.Cmd
+	m.panes[m.focus], cmd = m.panes[m.focus].Update(msg)
+	return m, cmd
+}
+
+func (m Model) updateSearch(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	switch msg.String() {
+	case "esc":
+		m.searching = false
+		m.search.Blur()
+		return m, nil
+	case "enter":
+		query := m.search.Value()
+		if query == "" {
+			return m, nil
+		}
+		m.searching = false
+		m.search.Blur()
+		m.startLoading(fmt.Sprintf("Searching '%s'...", query))
+		return m, searchCmd(query)
+	}
+
+	var cmd tea.Cmd
+	m.search, cmd = m.search.Update(msg)
+	return m, cmd
+}
+
+// back moves focus one step towards the series panes, mirroring 'q' in the old prompt loops.
+func (m *Model) back() {
+	switch m.focus {
+	case paneServers:
+		m.focus = paneEpisodes
+	case paneEpisodes:
+		m.focus = paneHistory
+	case paneSearch, paneWatchlist:
+		m.focus = paneHistory
+	}
+}
+
+// watchlistKey handles 'w' on a search result and 'd', 'K', 'J' in the watchlist pane. It reports whether the key was used.
+func (m *Model) watchlistKey(key string) bool {
+	switch item := m.panes[m.focus].SelectedItem().(type) {
+	case searchItem:
+		if key != "w" {
+			return false
+		}
+		if m.editWatchlist(func(list []state.WatchlistEntry) ([]state.WatchlistEntry, error) {
+			return state.AddToWatchlist(list, item.series.SeriesData())
+		}) {
+			m.status = fmt.Sprintf("Added %s to the watchlist", item.series.JapaneseName)
+		}
+		return true
+
+	case watchlistItem:
+		// The pane may be filtered, so the entry is found by url and positions count in the whole watchlist.
+		index := m.panes[paneWatchlist].GlobalIndex()
+		ref := item.entry.SeriesUrl
+		if ref == "" {
+			ref = strconv.Itoa(index + 1)
+		}
+		switch key {
+		case "d":
+			if m.editWatchlist(func(list []state.WatchlistEntry) ([]state.WatchlistEntry, error) {
+				return state.RemoveFromWatchlist(list, ref)
+			}) {
+				m.status = fmt.Sprintf("Removed %s from the watchlist", item.entry.JapaneseName)
+			}
+		case "K", "J":
+			to := index
+			if key == "J" {
+				to = index + 2
+			}
+			if to < 1 || to > len(m.watchlist) {
+				return true
+			}
+			if m.editWatchlist(func(list []state.WatchlistEntry) ([]state.WatchlistEntry, error) {
+				return state.MoveInWatchlist(list, ref, to)
+			}) && m.panes[paneWatchlist].FilterState() == list.Unfiltered {
+				m.panes[paneWatchlist].Select(to - 1)
+			}
+		default:
+			return false
+		}
+		return true
+	}
+
+	return false
+}
+
+func (m Model) selectItem() (tea.Model, tea.Cmd) {
+	selected := m.panes[m.focus].SelectedItem()
+	if selected == nil {
+		return m, nil
+	}
+
+	switch item := selected.(type) {
+	case historyItem:
+		m.startLoading(fmt.Sprintf("Loading %s...", item.history.JapaneseName))
+		return m, loadSeriesCmd(item.history.Url, m.history, m.episodes)
+
+	case watchlistItem:
+		// Opening a watchlist entry promotes it to the library.
+		promoted, library, err := state.PromoteFromWatchlist(item.entry.SeriesUrl)
+		if err != nil {
+			m.err = err
+			return m, nil
+		}
+		m.history = library
+		m.panes[paneHistory].SetItems(historyItems(state.Recent(m.history, state.RecentLimit)))
+		if watchlist, err := state.LoadWatchlist(); err == nil {
+			m.setWatchlist(watchlist)
+		}
+
+		m.startLoading(fmt.Sprintf("Loading %s...", promoted.JapaneseName))
+		return m, loadSeriesCmd(promoted.Url, m.history, m.episodes)
+
+	case searchItem:
+		m.startLoading(fmt.Sprintf("Loading %s...", item.series.JapaneseName))
+		return m, loadSeriesCmd(item.series.Url, m.history, m.episodes)
+
+	case episodeItem:
+		m.currentEpisode = item.episode
+		m.historySelect.LastEpisode = item.episode.Number
+		m.saveHistory()
+		m.refreshEpisodes()
+
+		m.startLoading(fmt.Sprintf("Fetching servers for episode %d...", item.episode.Number))
+		return m, loadServersCmd(item.episode)
+
+	case serverItem:
+		m.pickServer(item.server)
+		return m, m.play([]hianime.ServerList{item.server}, "")
+	}
+
+	return m, nil
+}
+
+// pickServer remembers the type of a server picked by hand, so the series tries it first next time.
+func (m *Model) pickServer(server hianime.ServerList) {
+	if server.Type != "" && m.historySelect.AudioType != server.Type {
+		m.historySelect.AudioType = server.Type
+		m.saveHistory()
+	}
+}
+
+// play starts the current episode on the first working server. resume overrides the resume config when set;
+// the interface can't ask while mpv runs, so "ask" resumes.
+func (m *Model) play(servers []hianime.ServerList, resume string) tea.Cmd {
+	m.startLoading(fmt.Sprintf("Playing episode %d...", m.currentEpisode.Number))
+
+	playConfig := m.config
+	if resume != "" {
+		playConfig.Resume = resume
+	}
+
+	return playCmd(&playback{
+		servers:  servers,
+		metaData: m.metaData,
+		episode:  m.currentEpisode,
+		history:  m.historySelect,
+		config:   playConfig,
+	})
+}
+
+func (m *Model) resize() {
+	// 2 lines for the status bar, and each pane loses 2 rows and columns to its border.
+	bodyHeight := m.height - 2
+	leftWidth := m.width * 2 / 5
+	rightWidth := m.width - leftWidth
+
+	historyHeight := bodyHeight / 3
+	watchlistHeight := bodyHeight / 3
+	searchHeight := bodyHeight - historyHeight - watchlistHeight
+
+	serversHeight := 10
+	if serversHeight > bodyHeight/2 {
+		serversHeight = bodyHeight / 2
+	}
+	episodesHeight := bodyHeight - serversHeight
+
+	m.panes[paneHistory].SetSize(leftWidth-2, historyHeight-2)
+	m.panes[paneWatchlist].SetSize(leftWidth-2, watchlistHeight-2)
+	m.panes[paneSearch].SetSize(leftWidth-2, searchHeight-2)
+	m.panes[paneEpisodes].SetSize(rightWidth-2, episodesHeight-2)
+	m.panes[paneServers].SetSize(rightWidth-2, serversHeight-2)
+	m.search.Width = m.width - len(m.search.Prompt) - 2
+}
+
+func (m Model) paneView(p pane) string {
+	style := borderStyle
+	if p == m.focus {
+		style = focusedStyle
+	}
+	return style.Width(m.panes[p].Width()).Height(m.panes[p].Height()).Render(m.panes[p].View())
+}
+
+func (m Model) statusView() string {
+	switch {
+	case m.searching:
+		return m.search.View()
+	case m.loading != "":
+		return fmt.Sprintf("%s %s", m.spinner.View(), m.loading)
+	case m.err != nil:
+		return errorStyle.Render(m.err.Error())
+	case m.status != "":
+		return statusStyle.Render(m.status)
+	}
+	return statusStyle.Render("tab: switch pane · enter: select · /: filter · s: search · w: add to watchlist · d/K/J: remove/move · esc: back · q: quit")
+}
+
+func (m Model) View() string {
+	if m.width == 0 {
+		return ""
+	}
+
+	left := lipgloss.JoinVertical(lipgloss.Left, m.paneView(paneHistory), m.paneView(paneWatchlist), m.paneView(paneSearch))
+	right := lipgloss.JoinVertical(lipgloss.Left, m.paneView(paneEpisodes), m.paneView(paneServers))
+	body := lipgloss.JoinHorizontal(lipgloss.Top, left, right)
+
+	return lipgloss.JoinVertical(lipgloss.Left, body, "", m.statusView())
+}
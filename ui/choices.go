@@ -0,0 +1,65 @@
+package ui
+
+import (
+	"fmt"
+
+	"hianime-mpv-go/hianime"
+	"hianime-mpv-go/selector"
+	"hianime-mpv-go/state"
+)
+
+// Builders for the fuzzy finder. The preview line carries what the tables print in their other columns.
+
+func SeriesChoices(searchData []hianime.SearchElements) []selector.Item[hianime.SearchElements] {
+	items := make([]selector.Item[hianime.SearchElements], 0, len(searchData))
+	for _, ins := range searchData {
+		numEps := ins.NumberEpisodes
+		if numEps == 0 {
+			numEps = 1
+		}
+
+		items = append(items, selector.Item[hianime.SearchElements]{
+			Label:   fmt.Sprintf("%s (%s)", ins.JapaneseName, ins.EnglishName),
+			Preview: fmt.Sprintf("Type: %s · Duration: %s · Episodes: %d", ins.Type, ins.Duration, numEps),
+			Value:   ins,
+		})
+	}
+	return items
+}
+
+func HistoryChoices(history []state.History) []selector.Item[state.History] {
+	items := make([]selector.Item[state.History], 0, len(history))
+	for _, ins := range history {
+		items = append(items, selector.Item[state.History]{
+			Label:   fmt.Sprintf("%s (%s)", ins.JapaneseName, ins.EnglishName),
+			Preview: fmt.Sprintf("Last episode: %d · Episodes with progress: %d", ins.LastEpisode, len(ins.Episode)),
+			Value:   ins,
+		})
+	}
+	return items
+}
+
+func EpisodeChoices(episodes []hianime.Episodes, history state.History) []selector.Item[hianime.Episodes] {
+	items := make([]selector.Item[hianime.Episodes], 0, len(episodes))
+	for _, eps := range episodes {
+		title := eps.JapaneseTitle
+		if title == "" {
+			title = eps.EnglishTitle
+		}
+
+		preview := eps.EnglishTitle
+		if info := WatchedInfo(history.Episode[eps.Number]); info != "" {
+			preview = fmt.Sprintf("%s · Watched %s", preview, info)
+		}
+		if eps.Number == history.LastEpisode {
+			preview += " · Last watched"
+		}
+
+		items = append(items, selector.Item[hianime.Episodes]{
+			Label:   fmt.Sprintf("[%02d] %s", eps.Number, title),
+			Preview: preview,
+			Value:   eps,
+		})
+	}
+	return items
+}
@@ -0,0 +1,62 @@
+package ui
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+)
+
+// JSONSchemaVersion is bumped whenever a field in the JSON output is renamed or removed. Adding fields doesn't bump it.
+const JSONSchemaVersion = 1
+
+type OutputFormat int
+
+const (
+	OutputText OutputFormat = iota
+	OutputJSON
+	OutputNDJSON
+)
+
+// Output is the format used by the subcommands, set from the -json and -ndjson flags.
+var Output OutputFormat = OutputText
+
+// jsonOutput keeps the real stdout, so in JSON mode main can point os.Stdout at stderr and the scraper logs don't end up in the stream.
+var jsonOutput io.Writer = os.Stdout
+
+// Record is the envelope around everything written in JSON mode, so consumers can check the version and kind first.
+type Record struct {
+	SchemaVersion int    `json:"schema_version"`
+	Kind          string `json:"kind"`
+	Data          any    `json:"data"`
+}
+
+// PrintRecords writes items either as one JSON document holding the whole list, or as one record per line in NDJSON mode.
+func PrintRecords[T any](kind string, items []T) error {
+	enc := json.NewEncoder(jsonOutput)
+
+	if Output == OutputNDJSON {
+		for _, item := range items {
+			if err := enc.Encode(Record{SchemaVersion: JSONSchemaVersion, Kind: kind, Data: item}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if items == nil {
+		items = []T{}
+	}
+
+	enc.SetIndent("", "  ")
+	return enc.Encode(Record{SchemaVersion: JSONSchemaVersion, Kind: kind, Data: items})
+}
+
+// PrintRecord writes a single object, for results like a resolved stream.
+func PrintRecord(kind string, item any) error {
+	enc := json.NewEncoder(jsonOutput)
+	if Output == OutputJSON {
+		enc.SetIndent("", "  ")
+	}
+
+	return enc.Encode(Record{SchemaVersion: JSONSchemaVersion, Kind: kind, Data: item})
+}
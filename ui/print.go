@@ -3,14 +3,19 @@ package ui
 import (
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 	"text/tabwriter"
+	"time"
 
 	"hianime-mpv-go/config"
 	"hianime-mpv-go/hianime"
 	"hianime-mpv-go/state"
+	"hianime-mpv-go/stats"
+	"hianime-mpv-go/updates"
 )
 
-func prettyDuration(seconds float64) string {
+func PrettyDuration(seconds float64) string {
 	m := int(seconds) / 60
 	s := int(seconds) % 60
 	return fmt.Sprintf("%02d:%02d", m, s)
@@ -18,7 +23,7 @@ func prettyDuration(seconds float64) string {
 
 func PrintEpisodes(episodes []hianime.Episodes, history state.History) {
 	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
-	fmt.Fprintln(w, "\tNO.\tEPS_NAME\tDURATION")
+	fmt.Fprintln(w, "\tNO.\tEPS_NAME\tWATCHED")
 
 	for _, eps := range episodes {
 		prefix := "  "
@@ -26,12 +31,7 @@ func PrintEpisodes(episodes []hianime.Episodes, history state.History) {
 			prefix = "-->"
 		}
 
-		timeInfo := ""
-		if prog, ok := history.Episode[eps.Number]; ok {
-			curr := prettyDuration(prog.Position)
-			total := prettyDuration(prog.Duration)
-			timeInfo = fmt.Sprintf("%s/%s", curr, total)
-		}
+		timeInfo := WatchedInfo(history.Episode[eps.Number])
 
 		var title string
 		if eps.JapaneseTitle == "" {
@@ -45,6 +45,20 @@ func PrintEpisodes(episodes []hianime.Episodes, history state.History) {
 
 }
 
+// WatchedInfo describes the progress of an episode: ✓ once watched, the position when it was only started,
+// nothing when it never was.
+func WatchedInfo(prog state.EpisodeProgress) string {
+	switch {
+	case prog.Watched && prog.Rewatches > 0:
+		return fmt.Sprintf("✓ (%dx)", prog.Rewatches+1)
+	case prog.Watched:
+		return "✓"
+	case prog.Partial():
+		return fmt.Sprintf("%s/%s", PrettyDuration(prog.Position), PrettyDuration(prog.Duration))
+	}
+	return ""
+}
+
 func DebugPrint(format string, contents ...any) {
 	if config.DebugMode {
 		prefix := "[ DEBUG ] "
@@ -73,3 +87,201 @@ func PrintSeries(searchData []hianime.SearchElements) {
 
 	w.Flush()
 }
+
+func PrintHistory(history []state.History) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+
+	fmt.Fprintln(w, "NO.\tNAME\tLAST EPS\tURL")
+	for i := range history {
+		ins := history[i]
+
+		fmt.Fprintf(w, "[%d]\t%s\t%d\t%s\n",
+			i+1,
+			ins.JapaneseName,
+			ins.LastEpisode,
+			ins.Url,
+		)
+	}
+
+	w.Flush()
+}
+
+func PrintServers(servers []hianime.ServerList) {
+	for i := range servers {
+		serverIns := servers[i]
+
+		if serverIns.Type == "dub" {
+			fmt.Printf(" [%d] %s (Dub)\n", i+1, serverIns.Name)
+		} else {
+			fmt.Printf(" [%d] %s\n", i+1, serverIns.Name)
+		}
+	}
+}
+
+func PrintStream(server hianime.ServerList, streamData hianime.StreamData) {
+	fmt.Printf("Server:  %s (%s)\n", server.Name, server.Type)
+	fmt.Printf("Url:     %s\n", streamData.Url)
+	fmt.Printf("Referer: %s\n", streamData.Referer)
+
+	for _, track := range streamData.Tracks {
+		if track.Kind == "thumbnails" {
+			continue
+		}
+		fmt.Printf("Track:   %s %s\n", track.Label, track.File)
+	}
+}
+
+// PrintLibrary prints entries, numbered by their position in the whole library.
+func PrintLibrary(library []state.History, entries []state.History) {
+	position := make(map[string]int, len(library))
+	for i := range library {
+		position[library[i].Key()] = i + 1
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+
+	fmt.Fprintln(w, "NO.\tNAME\tSTATUS\tLAST EPS\tURL")
+	for _, ins := range entries {
+		status := ins.GetStatus()
+		if ins.Archived {
+			status += " (archived)"
+		}
+
+		fmt.Fprintf(w, "[%d]\t%s\t%s\t%d\t%s\n",
+			position[ins.Key()],
+			ins.JapaneseName,
+			status,
+			ins.LastEpisode,
+			ins.Url,
+		)
+	}
+
+	w.Flush()
+}
+
+func PrintWatchlist(list []state.WatchlistEntry) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+
+	fmt.Fprintln(w, "NO.\tNAME\tADDED\tURL")
+	for i, ins := range list {
+		fmt.Fprintf(w, "[%d]\t%s\t%s\t%s\n",
+			i+1,
+			ins.JapaneseName,
+			ins.AddedAt.Format("2006-01-02"),
+			ins.SeriesUrl,
+		)
+	}
+
+	w.Flush()
+}
+
+// PrintNewEpisodes reports the series with new episodes and the ones that couldn't be checked.
+func PrintNewEpisodes(results []updates.Result) {
+	found := 0
+	for _, r := range results {
+		if r.Err != nil {
+			fmt.Printf("--! %s: failed to check (%v)\n", r.Series.JapaneseName, r.Err)
+			continue
+		}
+		if len(r.Episodes) == 0 {
+			continue
+		}
+
+		found++
+		fmt.Printf("--> %s: %d new episode(s)\n", r.Series.JapaneseName, len(r.Episodes))
+		for _, eps := range r.Episodes {
+			fmt.Printf("    [%02d] %s\n", eps.Number, eps.EnglishTitle)
+		}
+	}
+
+	if found == 0 {
+		fmt.Printf("--> No new episodes in %d series.\n", len(results))
+	}
+}
+
+// PrettyTotal formats a long span of watching time, e.g. "12h 05m".
+func PrettyTotal(seconds float64) string {
+	minutes := int(seconds) / 60
+	if minutes < 60 {
+		return fmt.Sprintf("%dm", minutes)
+	}
+	return fmt.Sprintf("%dh %02dm", minutes/60, minutes%60)
+}
+
+// PrintStats prints the summary of report, its limit most recent totals and its series.
+func PrintStats(report stats.Report, limit int) {
+	fmt.Printf("--> Watched %s in %d session(s), %s on average\n", PrettyTotal(report.Seconds), report.Sessions, PrettyTotal(report.AverageSession))
+	fmt.Printf("--> %d of %d episodes started were watched to the end (%.0f%%)\n", report.EpisodesWatched, report.EpisodesStarted, report.Completion*100)
+	if report.LongestStreak > 0 {
+		fmt.Printf("--> Longest streak: %d day(s) from %s, current streak: %d day(s)\n",
+			report.LongestStreak, report.StreakStart.Format("2006-01-02"), report.CurrentStreak)
+	}
+
+	if len(report.Totals) > 0 {
+		fmt.Println()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintf(w, "%s\tSESSIONS\tTIME\tEPISODES\n", strings.ToUpper(report.Period))
+		for i, t := range report.Totals {
+			if i == limit {
+				break
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%d\n", t.Period, t.Sessions, PrettyTotal(t.Seconds), t.Episodes)
+		}
+		w.Flush()
+	}
+
+	if len(report.Series) > 0 {
+		fmt.Println()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		fmt.Fprintln(w, "NAME\tSESSIONS\tTIME\tWATCHED\tCOMPLETION")
+		for _, s := range report.Series {
+			completion := "-"
+			if s.Episodes > 0 {
+				completion = fmt.Sprintf("%.0f%%", s.Completion*100)
+			}
+			watched := strconv.Itoa(s.Watched)
+			if s.Episodes > 0 {
+				watched = fmt.Sprintf("%d/%d", s.Watched, s.Episodes)
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\t%s\n", s.Name, s.Sessions, PrettyTotal(s.Seconds), watched, completion)
+		}
+		w.Flush()
+	}
+}
+
+// PrintSettings prints every setting with its value and where the value comes from.
+func PrintSettings(entries []config.Entry) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "KEY\tVALUE\tSOURCE\tENV")
+	for _, e := range entries {
+		value := e.Value
+		if value == "" {
+			value = `""`
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", e.Key, value, e.Source, e.Env)
+	}
+	w.Flush()
+}
+
+// PrintServerStats prints the statistics of the servers with their score at now.
+func PrintServerStats(stats []state.ServerStats, now time.Time) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+	fmt.Fprintln(w, "SERVER\tSCORE\tRESOLVED\tFAILED\tSTARTED\tFAILED\tFIRST FRAME\tLAST SUCCESS\tLAST FAILURE")
+	for _, s := range stats {
+		firstFrame := "-"
+		if s.Started > 0 {
+			firstFrame = fmt.Sprintf("%.1fs", s.AverageFirstFrame())
+		}
+		fmt.Fprintf(w, "%s\t%.0f%%\t%d\t%d\t%d\t%d\t%s\t%s\t%s\n",
+			s.Name, s.Score(now)*100, s.Resolved, s.ResolveFailed, s.Started, s.StartFailed, firstFrame,
+			formatDate(s.LastSuccess), formatDate(s.LastFailure))
+	}
+	w.Flush()
+}
+
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
@@ -0,0 +1,132 @@
+package updates
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"hianime-mpv-go/hianime"
+	"hianime-mpv-go/paths"
+	"hianime-mpv-go/state"
+)
+
+// site stands in for hianime's episode list endpoint, serving a count of episodes per anime id.
+type site struct {
+	mu       sync.Mutex
+	counts   map[string]int // anime id to episode count, missing ids answer 503
+	requests []string
+}
+
+func (s *site) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	animeID, ok := strings.CutPrefix(r.URL.Path, "/ajax/v2/episode/list/")
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.mu.Lock()
+	s.requests = append(s.requests, animeID)
+	count, exists := s.counts[animeID]
+	s.mu.Unlock()
+	if !exists {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	var list strings.Builder
+	for i := 1; i <= count; i++ {
+		fmt.Fprintf(&list, `<a class="ep-item" href="/watch/series-%s?ep=%d" data-id="%d"><div class="ep-name" data-jname="Dai %d-wa">Episode %d</div></a>`,
+			animeID, 9000+i, 9000+i, i, i)
+	}
+	json.NewEncoder(w).Encode(hianime.AjaxResponse{Status: true, Html: list.String()})
+}
+
+func (s *site) requested() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+func (s *site) setCount(animeID string, count int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts[animeID] = count
+}
+
+// serve points hianime at a stand-in site and gives the test its own data directory.
+func serve(t *testing.T, counts map[string]int) *site {
+	t.Helper()
+	paths.DataDir = t.TempDir()
+	state.DefaultStore = &state.JSONStore{}
+	t.Cleanup(func() { paths.DataDir = "" })
+
+	s := &site{counts: counts}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+
+	baseUrl := hianime.BaseUrl
+	hianime.BaseUrl = srv.URL
+	t.Cleanup(func() { hianime.BaseUrl = baseUrl })
+	return s
+}
+
+func TestCheckAgainstSite(t *testing.T) {
+	s := serve(t, map[string]int{"100": 12, "200": 5})
+
+	library := []state.History{
+		{AnimeID: "100", Url: "https://hianime.to/one-piece-100", Status: state.StatusWatching, KnownEpisodes: 10},
+		{AnimeID: "200", Url: "https://hianime.to/frieren-200", Status: state.StatusWatching},
+		{AnimeID: "300", Url: "https://hianime.to/naruto-300", Status: state.StatusWatching, KnownEpisodes: 3},
+		{AnimeID: "400", Url: "https://hianime.to/bleach-400", Status: state.StatusCompleted, KnownEpisodes: 1},
+	}
+	if err := state.SaveHistory(library); err != nil {
+		t.Fatal(err)
+	}
+
+	results := Check(Followed(library), 2, hianime.FetchEpisodes)
+	if requested := s.requested(); len(requested) != 3 {
+		t.Errorf("requested %v, want the 3 series being watched", requested)
+	}
+	if len(results) != 3 {
+		t.Fatalf("got %d results, want 3", len(results))
+	}
+
+	onePiece := results[0]
+	if onePiece.Err != nil || onePiece.Total != 12 || len(onePiece.Episodes) != 2 {
+		t.Fatalf("one piece: %+v, want episodes 11 and 12", onePiece)
+	}
+	ep := onePiece.Episodes[0]
+	if ep.Number != 11 || ep.Id != 9011 || ep.EnglishTitle != "Episode 11" || ep.JapaneseTitle != "Dai 11-wa" || ep.Url != hianime.BaseUrl+"/watch/series-100?ep=9011" {
+		t.Errorf("got %+v, want episode 11 as scraped from the list", ep)
+	}
+	if results[1].Err != nil || results[1].Total != 5 || len(results[1].Episodes) != 0 {
+		t.Errorf("frieren: %+v, want the first check as the baseline", results[1])
+	}
+	if results[2].Err == nil || !strings.Contains(results[2].Error, "503") {
+		t.Errorf("naruto: %+v, want the 503 reported", results[2])
+	}
+
+	if _, err := Record(results); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := state.LoadHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, want := range []int{12, 5, 3, 1} {
+		if stored[i].KnownEpisodes != want {
+			t.Errorf("%s knows %d episodes, want %d", stored[i].Url, stored[i].KnownEpisodes, want)
+		}
+	}
+
+	// A new episode of Frieren is found on the next check, against the recorded baseline.
+	s.setCount("200", 6)
+	results = Check(Followed(stored), 2, hianime.FetchEpisodes)
+	if found := WithNew(results); len(found) != 1 || found[0].Series.AnimeID != "200" || found[0].Episodes[0].Number != 6 {
+		t.Errorf("WithNew = %+v, want episode 6 of frieren", found)
+	}
+}
@@ -0,0 +1,117 @@
+// Package updates checks the series being followed for episodes released since the last check.
+package updates
+
+import (
+	"sync"
+
+	"hianime-mpv-go/hianime"
+	"hianime-mpv-go/state"
+)
+
+// DefaultWorkers is how many episode lists are fetched at the same time.
+const DefaultWorkers = 4
+
+// Fetcher returns the episode list of a series. hianime.FetchEpisodes in the program, a fake in tests.
+type Fetcher func(animeID string) ([]hianime.Episodes, error)
+
+// Result is the outcome of checking one series.
+type Result struct {
+	Series   state.History      `json:"series"`
+	Known    int                `json:"known"`    // episode count before this check, 0 if never checked
+	Total    int                `json:"total"`    // episode count now
+	Episodes []hianime.Episodes `json:"episodes"` // the new episodes
+	Err      error              `json:"-"`
+	Error    string             `json:"error,omitempty"`
+}
+
+// Followed returns the series worth checking: the ones being watched that aren't archived.
+// Series never checked before use the length of their stored episode list as the known count.
+func Followed(library []state.History) []state.History {
+	followed := state.FilterLibrary(library, state.LibraryFilter{Status: state.StatusWatching})
+	for i := range followed {
+		if followed[i].KnownEpisodes > 0 {
+			continue
+		}
+		if episodes, exists, err := state.DefaultStore.LoadEpisodes(followed[i].AnimeID); err == nil && exists {
+			followed[i].KnownEpisodes = len(episodes)
+		}
+	}
+	return followed
+}
+
+// Check fetches the episode list of every series with at most workers requests in flight.
+// Results are in the same order as series. A series never checked before reports no new episodes,
+// its count only becomes the baseline for the next check.
+func Check(series []state.History, workers int, fetch Fetcher) []Result {
+	if workers < 1 {
+		workers = 1
+	}
+
+	results := make([]Result, len(series))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers && w < len(series); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = checkSeries(series[i], fetch)
+			}
+		}()
+	}
+
+	for i := range series {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results
+}
+
+func checkSeries(h state.History, fetch Fetcher) Result {
+	result := Result{Series: h, Known: h.KnownEpisodes}
+
+	episodes, err := fetch(h.AnimeID)
+	if err != nil {
+		result.Err, result.Error = err, err.Error()
+		return result
+	}
+
+	result.Total = len(episodes)
+	if h.KnownEpisodes > 0 && len(episodes) > h.KnownEpisodes {
+		result.Episodes = episodes[h.KnownEpisodes:]
+	}
+	return result
+}
+
+// Record stores the episode counts of the successful checks, so the next check only reports newer episodes.
+func Record(results []Result) ([]state.History, error) {
+	counts := make(map[string]int)
+	for _, r := range results {
+		if r.Err == nil {
+			counts[r.Series.Key()] = r.Total
+		}
+	}
+
+	return state.UpdateLibrary(func(library []state.History) ([]state.History, error) {
+		for i := range library {
+			if total, ok := counts[library[i].Key()]; ok {
+				library[i].KnownEpisodes = total
+			}
+		}
+		return library, nil
+	})
+}
+
+// WithNew returns the results that found new episodes.
+func WithNew(results []Result) []Result {
+	var found []Result
+	for _, r := range results {
+		if len(r.Episodes) > 0 {
+			found = append(found, r)
+		}
+	}
+	return found
+}
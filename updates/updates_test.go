@@ -0,0 +1,116 @@
+package updates
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"hianime-mpv-go/hianime"
+	"hianime-mpv-go/state"
+)
+
+func episodes(n int) []hianime.Episodes {
+	list := make([]hianime.Episodes, n)
+	for i := range list {
+		list[i] = hianime.Episodes{Number: i + 1, Id: 1000 + i}
+	}
+	return list
+}
+
+func series(id string, known int) state.History {
+	return state.History{AnimeID: id, Url: "https://hianime.to/series-" + id, KnownEpisodes: known}
+}
+
+func TestCheckBoundsWorkers(t *testing.T) {
+	const workers = 3
+
+	var mu sync.Mutex
+	inFlight, peak := 0, 0
+	fetch := func(animeID string) ([]hianime.Episodes, error) {
+		mu.Lock()
+		inFlight++
+		peak = max(peak, inFlight)
+		mu.Unlock()
+
+		time.Sleep(10 * time.Millisecond)
+
+		mu.Lock()
+		inFlight--
+		mu.Unlock()
+		return episodes(1), nil
+	}
+
+	var list []state.History
+	for i := range 12 {
+		list = append(list, series(fmt.Sprint(i), 1))
+	}
+
+	results := Check(list, workers, fetch)
+	if len(results) != len(list) {
+		t.Fatalf("got %d results, want %d", len(results), len(list))
+	}
+	if peak > workers {
+		t.Errorf("%d fetches in flight, want at most %d", peak, workers)
+	}
+	for i, r := range results {
+		if r.Series.AnimeID != list[i].AnimeID {
+			t.Errorf("result %d is %s, want the order of the series", i, r.Series.AnimeID)
+		}
+	}
+}
+
+func TestCheckFirstCheckIsBaseline(t *testing.T) {
+	fetch := func(string) ([]hianime.Episodes, error) { return episodes(12), nil }
+
+	results := Check([]state.History{series("1", 0)}, 1, fetch)
+	r := results[0]
+	if len(r.Episodes) != 0 {
+		t.Errorf("got %d new episodes on the first check, want none", len(r.Episodes))
+	}
+	if r.Total != 12 || r.Known != 0 {
+		t.Errorf("got known %d total %d, want 0 and 12", r.Known, r.Total)
+	}
+	if len(WithNew(results)) != 0 {
+		t.Error("WithNew reports a series never checked before")
+	}
+}
+
+func TestCheckSlicesNewEpisodes(t *testing.T) {
+	fetch := func(string) ([]hianime.Episodes, error) { return episodes(10), nil }
+
+	results := Check([]state.History{series("1", 7), series("2", 10)}, 2, fetch)
+
+	got := results[0].Episodes
+	if len(got) != 3 || got[0].Number != 8 || got[2].Number != 10 {
+		t.Errorf("got %+v, want episodes 8 to 10", got)
+	}
+	if len(results[1].Episodes) != 0 {
+		t.Errorf("got %d new episodes for an up to date series", len(results[1].Episodes))
+	}
+	if found := WithNew(results); len(found) != 1 || found[0].Series.AnimeID != "1" {
+		t.Errorf("WithNew = %+v, want only series 1", found)
+	}
+}
+
+func TestCheckKeepsPerSeriesErrors(t *testing.T) {
+	failure := errors.New("503 Service Unavailable")
+	fetch := func(animeID string) ([]hianime.Episodes, error) {
+		if animeID == "2" {
+			return nil, failure
+		}
+		return episodes(5), nil
+	}
+
+	results := Check([]state.History{series("1", 4), series("2", 4), series("3", 4)}, 2, fetch)
+
+	if !errors.Is(results[1].Err, failure) || results[1].Error != failure.Error() {
+		t.Errorf("got %v / %q, want the fetch error", results[1].Err, results[1].Error)
+	}
+	for _, i := range []int{0, 2} {
+		if results[i].Err != nil || len(results[i].Episodes) != 1 {
+			t.Errorf("series %s: got %v and %d new, want no error and 1 new", results[i].Series.AnimeID, results[i].Err, len(results[i].Episodes))
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"hianime-mpv-go/config"
+	"hianime-mpv-go/state"
+	"hianime-mpv-go/watcher"
+)
+
+func cmdWatch(args []string, history []state.History, configSession config.Settings) error {
+	fs := newFlagSet("watch")
+	interval := fs.String("interval", configSession.Watch.Interval, "Time between checks, e.g. 30m (overrides config)")
+	jitter := fs.String("jitter", configSession.Watch.Jitter, "Random extra delay of up to this much per check (overrides config)")
+	once := fs.Bool("once", false, "Check once, fire the hooks and exit")
+
+	positional, err := parseInterleaved(fs, args)
+	if err != nil || len(positional) != 0 {
+		return errUsage
+	}
+
+	settings := configSession.Watch
+	settings.Interval, settings.Jitter = *interval, *jitter
+	w, err := watcher.New(settings)
+	if err != nil {
+		return err
+	}
+
+	if *once {
+		return w.Poll(time.Now())
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	fmt.Printf("--> Watching for new episodes every %s (ctrl+c to stop)\n", w.Interval)
+	return w.Run(ctx)
+}
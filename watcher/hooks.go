@@ -0,0 +1,199 @@
+package watcher
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"hianime-mpv-go/hianime"
+	"hianime-mpv-go/state"
+)
+
+// StatusQueued is the status of a download added by the download hook.
+const StatusQueued = "queued"
+
+// hookTimeout bounds every hook, so a hanging command or webhook can't stall the next poll.
+const hookTimeout = 30 * time.Second
+
+// Event is what the hooks receive for one series with new episodes. It is also the webhook payload.
+type Event struct {
+	Event     string             `json:"event"` // always "new_episodes"
+	SeriesKey string             `json:"series_key"`
+	AnimeID   string             `json:"anime_id"`
+	Name      string             `json:"jp_name"`
+	Url       string             `json:"url"`
+	Known     int                `json:"known"`
+	Total     int                `json:"total"`
+	Episodes  []hianime.Episodes `json:"episodes"`
+	CheckedAt time.Time          `json:"checked_at"`
+}
+
+// Hooks are run for every Event. Empty or false fields are skipped.
+type Hooks struct {
+	Command    string
+	WebhookURL string
+	Notify     bool
+	Download   bool
+
+	// Client sends the webhook. nil means a client with hookTimeout.
+	Client *http.Client
+}
+
+// Names of the hooks, as passed to and returned by Fire.
+const (
+	HookCommand  = "command"
+	HookWebhook  = "webhook"
+	HookNotify   = "notify"
+	HookDownload = "download"
+)
+
+// Enabled returns the names of the configured hooks, in the order they run.
+func (h Hooks) Enabled() []string {
+	var names []string
+	if h.Command != "" {
+		names = append(names, HookCommand)
+	}
+	if h.WebhookURL != "" {
+		names = append(names, HookWebhook)
+	}
+	if h.Notify {
+		names = append(names, HookNotify)
+	}
+	if h.Download {
+		names = append(names, HookDownload)
+	}
+	return names
+}
+
+// Fire runs the named hooks for event and returns the errors of the ones that failed, by hook name.
+func (h Hooks) Fire(event Event, names []string) map[string]error {
+	errs := make(map[string]error)
+	for _, name := range names {
+		var err error
+		switch name {
+		case HookCommand:
+			if err = h.runCommand(event); err != nil {
+				err = fmt.Errorf("Command hook failed: %w", err)
+			}
+		case HookWebhook:
+			if err = h.postWebhook(event); err != nil {
+				err = fmt.Errorf("Webhook hook failed: %w", err)
+			}
+		case HookNotify:
+			if err = notify(event); err != nil {
+				err = fmt.Errorf("Notification failed: %w", err)
+			}
+		case HookDownload:
+			if err = enqueueDownloads(event); err != nil {
+				err = fmt.Errorf("Failed to queue the downloads: %w", err)
+			}
+		}
+		if err != nil {
+			errs[name] = err
+		}
+	}
+	return errs
+}
+
+// runCommand runs the command through the shell with the event as JSON on stdin and a summary in HIANIME_* variables.
+func (h Hooks) runCommand(event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", h.Command)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", h.Command)
+	}
+
+	numbers := make([]string, len(event.Episodes))
+	for i, eps := range event.Episodes {
+		numbers[i] = strconv.Itoa(eps.Number)
+	}
+	cmd.Env = append(os.Environ(),
+		"HIANIME_SERIES="+event.Name,
+		"HIANIME_URL="+event.Url,
+		"HIANIME_EPISODES="+strings.Join(numbers, ","),
+	)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
+
+func (h Hooks) postWebhook(event Event) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	client := h.Client
+	if client == nil {
+		client = &http.Client{Timeout: hookTimeout}
+	}
+
+	resp, err := client.Post(h.WebhookURL, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s returned %s", h.WebhookURL, resp.Status)
+	}
+	return nil
+}
+
+// NotifySupported reports whether desktop notifications can be shown on this system.
+func NotifySupported() bool {
+	return runtime.GOOS == "linux" || runtime.GOOS == "darwin"
+}
+
+// notify shows a desktop notification with notify-send on Linux and osascript on macOS.
+func notify(event Event) error {
+	title := "New episodes: " + event.Name
+	body := fmt.Sprintf("%d new episode(s), now %d in total", len(event.Episodes), event.Total)
+
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+
+	switch runtime.GOOS {
+	case "linux":
+		return exec.CommandContext(ctx, "notify-send", "--app-name=hianime-mpv", title, body).Run()
+	case "darwin":
+		script := fmt.Sprintf("display notification %q with title %q", body, title)
+		return exec.CommandContext(ctx, "osascript", "-e", script).Run()
+	}
+	return fmt.Errorf("desktop notifications aren't supported on %s, use a command hook instead", runtime.GOOS)
+}
+
+func enqueueDownloads(event Event) error {
+	for _, eps := range event.Episodes {
+		err := state.DefaultStore.AddDownload(state.DownloadRecord{
+			SeriesKey: event.SeriesKey,
+			Episode:   eps.Number,
+			Url:       eps.Url,
+			Status:    StatusQueued,
+			CreatedAt: event.CheckedAt,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,216 @@
+// Package watcher polls the series being watched for new episodes and runs the configured hooks when some are out.
+package watcher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"runtime"
+	"time"
+
+	"hianime-mpv-go/config"
+	"hianime-mpv-go/hianime"
+	"hianime-mpv-go/state"
+	"hianime-mpv-go/updates"
+)
+
+const (
+	DefaultInterval = 30 * time.Minute
+	DefaultJitter   = 5 * time.Minute
+
+	// maxBackoff caps how long a failing series, or the whole poll, waits before the next try.
+	maxBackoff = 6 * time.Hour
+
+	// LastCheckSetting is the store setting holding the time of the last poll.
+	LastCheckSetting = "watch_last_check"
+)
+
+// Watcher keeps the episode counts of the followed series up to date. The counts live in the store,
+// so a restarted watcher only reports episodes released since the last poll.
+type Watcher struct {
+	Interval time.Duration
+	Jitter   time.Duration
+	Workers  int
+	Hooks    Hooks
+	Fetch    updates.Fetcher
+
+	failures     map[string]int       // consecutive failures per series key
+	retryAt      map[string]time.Time // series skipped until then
+	pending      map[string][]retry   // hooks that failed, per series key, run again once the series is due
+	pollFailures int
+}
+
+// retry is an event whose hooks partly failed. Only the failed hooks run again, the others already did their job.
+type retry struct {
+	event Event
+	hooks []string
+}
+
+// New builds a Watcher from the watch section of the config.
+func New(settings config.WatchSettings) (*Watcher, error) {
+	w := &Watcher{
+		Interval: DefaultInterval,
+		Jitter:   DefaultJitter,
+		Workers:  updates.DefaultWorkers,
+		Hooks: Hooks{
+			Command:    settings.Command,
+			WebhookURL: settings.WebhookURL,
+			Notify:     settings.Notify,
+			Download:   settings.Download,
+		},
+		Fetch: hianime.FetchEpisodes,
+	}
+
+	if settings.Notify && !NotifySupported() {
+		return nil, fmt.Errorf("Desktop notifications aren't supported on %s, turn watch.notify off and use a command hook instead", runtime.GOOS)
+	}
+
+	if settings.Interval != "" {
+		interval, err := time.ParseDuration(settings.Interval)
+		if err != nil || interval <= 0 {
+			return nil, fmt.Errorf("Invalid watch interval '%s', use e.g. 30m or 2h", settings.Interval)
+		}
+		w.Interval = interval
+	}
+	if settings.Jitter != "" {
+		jitter, err := time.ParseDuration(settings.Jitter)
+		if err != nil || jitter < 0 {
+			return nil, fmt.Errorf("Invalid watch jitter '%s', use e.g. 5m or 0", settings.Jitter)
+		}
+		w.Jitter = jitter
+	}
+
+	return w, nil
+}
+
+// Run polls until ctx is cancelled.
+func (w *Watcher) Run(ctx context.Context) error {
+	for {
+		wait := w.nextWait()
+		if err := w.Poll(time.Now()); err != nil {
+			w.pollFailures++
+			wait = w.backoff(w.pollFailures)
+			fmt.Printf("--! Poll failed: %v. Retrying in %s\n", err, wait.Round(time.Second))
+		} else {
+			w.pollFailures = 0
+			fmt.Printf("--> Next check in %s\n", wait.Round(time.Second))
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Poll checks every followed series that isn't backing off, fires the hooks for the new episodes and stores the counts.
+// A series whose check failed keeps its old count, so its episodes are reported again on the next try. Hooks that
+// failed are retried on their own with the same episodes, the count being stored already.
+func (w *Watcher) Poll(now time.Time) error {
+	if w.failures == nil {
+		w.failures = make(map[string]int)
+		w.retryAt = make(map[string]time.Time)
+		w.pending = make(map[string][]retry)
+	}
+
+	// Reloaded every time, the library may have been changed by another session.
+	library, err := state.LoadHistory()
+	if err != nil {
+		return err
+	}
+
+	var due []state.History
+	for _, h := range updates.Followed(library) {
+		if now.Before(w.retryAt[h.Key()]) {
+			continue
+		}
+		due = append(due, h)
+	}
+	if len(due) == 0 {
+		return nil
+	}
+
+	results := updates.Check(due, w.Workers, w.Fetch)
+	for _, r := range results {
+		key := r.Series.Key()
+
+		var errs []error
+		if r.Err != nil {
+			errs = append(errs, r.Err)
+		}
+		retries := w.pending[key]
+		delete(w.pending, key)
+		for _, p := range retries {
+			errs = append(errs, w.fire(key, p.event, p.hooks)...)
+		}
+		if r.Err == nil && len(r.Episodes) > 0 {
+			fmt.Printf("--> %s: %d new episode(s)\n", r.Series.JapaneseName, len(r.Episodes))
+			errs = append(errs, w.fire(key, newEvent(r, now), w.Hooks.Enabled())...)
+		}
+
+		if len(errs) > 0 {
+			w.failures[key]++
+			w.retryAt[key] = now.Add(w.backoff(w.failures[key]))
+			fmt.Printf("--! %s: %v\n", r.Series.JapaneseName, errors.Join(errs...))
+			continue
+		}
+		delete(w.failures, key)
+		delete(w.retryAt, key)
+	}
+
+	if _, err := updates.Record(results); err != nil {
+		return fmt.Errorf("Failed to save the episode counts: %w", err)
+	}
+	return state.DefaultStore.SetSetting(LastCheckSetting, now.Format(time.RFC3339))
+}
+
+// fire runs hooks for event and keeps the ones that failed to be retried.
+func (w *Watcher) fire(key string, event Event, hooks []string) []error {
+	failed := w.Hooks.Fire(event, hooks)
+
+	var errs []error
+	var again []string
+	for _, name := range hooks {
+		if err, ok := failed[name]; ok {
+			errs = append(errs, err)
+			again = append(again, name)
+		}
+	}
+	if len(again) > 0 {
+		w.pending[key] = append(w.pending[key], retry{event: event, hooks: again})
+	}
+	return errs
+}
+
+func newEvent(r updates.Result, now time.Time) Event {
+	return Event{
+		Event:     "new_episodes",
+		SeriesKey: r.Series.Key(),
+		AnimeID:   r.Series.AnimeID,
+		Name:      r.Series.JapaneseName,
+		Url:       r.Series.Url,
+		Known:     r.Known,
+		Total:     r.Total,
+		Episodes:  r.Episodes,
+		CheckedAt: now,
+	}
+}
+
+// nextWait is the interval plus a random share of the jitter, so several watchers don't hit the site at the same moment.
+func (w *Watcher) nextWait() time.Duration {
+	if w.Jitter <= 0 {
+		return w.Interval
+	}
+	return w.Interval + rand.N(w.Jitter)
+}
+
+// backoff doubles the interval for every consecutive failure, up to maxBackoff.
+func (w *Watcher) backoff(failures int) time.Duration {
+	wait := w.Interval
+	for i := 1; i < failures && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, maxBackoff)
+}
@@ -0,0 +1,228 @@
+package watcher
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"hianime-mpv-go/config"
+	"hianime-mpv-go/hianime"
+	"hianime-mpv-go/paths"
+	"hianime-mpv-go/state"
+)
+
+// receiver is a local webhook endpoint answering with the queued statuses, then 200.
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	events   []Event
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	var event Event
+	if err := json.NewDecoder(req.Body).Decode(&event); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status, r.statuses = r.statuses[0], r.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+func (r *receiver) received() []Event {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Event(nil), r.events...)
+}
+
+// setup gives the test its own data directory holding one series being watched, with known episodes.
+func setup(t *testing.T, known int) {
+	t.Helper()
+	paths.DataDir = t.TempDir()
+	state.DefaultStore = &state.JSONStore{}
+	t.Cleanup(func() { paths.DataDir = "" })
+
+	series := state.History{
+		AnimeID:       "100",
+		Url:           "https://hianime.to/one-piece-100",
+		JapaneseName:  "One Piece",
+		Status:        state.StatusWatching,
+		KnownEpisodes: known,
+	}
+	if err := state.SaveHistory([]state.History{series}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func fetchCount(n int) func(string) ([]hianime.Episodes, error) {
+	return func(string) ([]hianime.Episodes, error) {
+		list := make([]hianime.Episodes, n)
+		for i := range list {
+			list[i] = hianime.Episodes{Number: i + 1}
+		}
+		return list, nil
+	}
+}
+
+func knownEpisodes(t *testing.T) int {
+	t.Helper()
+	library, err := state.LoadHistory()
+	if err != nil || len(library) != 1 {
+		t.Fatalf("library: %v %v", library, err)
+	}
+	return library[0].KnownEpisodes
+}
+
+func newWatcher(srv *httptest.Server, fetch func(string) ([]hianime.Episodes, error)) *Watcher {
+	return &Watcher{
+		Interval: time.Minute,
+		Workers:  1,
+		Hooks:    Hooks{WebhookURL: srv.URL, Client: srv.Client()},
+		Fetch:    fetch,
+	}
+}
+
+func TestPollPostsWebhook(t *testing.T) {
+	setup(t, 10)
+	recv := &receiver{}
+	srv := httptest.NewServer(recv)
+	defer srv.Close()
+
+	w := newWatcher(srv, fetchCount(12))
+	now := time.Now()
+	if err := w.Poll(now); err != nil {
+		t.Fatal(err)
+	}
+
+	events := recv.received()
+	if len(events) != 1 {
+		t.Fatalf("got %d webhook posts, want 1", len(events))
+	}
+	e := events[0]
+	if e.Event != "new_episodes" || e.AnimeID != "100" || e.Known != 10 || e.Total != 12 || len(e.Episodes) != 2 || e.Episodes[0].Number != 11 {
+		t.Errorf("got %+v, want episodes 11 and 12 of series 100", e)
+	}
+	if got := knownEpisodes(t); got != 12 {
+		t.Errorf("known episodes %d, want 12", got)
+	}
+
+	// Nothing new since, so nothing is sent again.
+	if err := w.Poll(now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(recv.received()); n != 1 {
+		t.Errorf("got %d webhook posts, want still 1", n)
+	}
+}
+
+func TestPollRetriesOnlyFailedHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the command hook test uses sh")
+	}
+	setup(t, 10)
+	recv := &receiver{statuses: []int{http.StatusInternalServerError}}
+	srv := httptest.NewServer(recv)
+	defer srv.Close()
+
+	ran := filepath.Join(t.TempDir(), "ran")
+	w := newWatcher(srv, fetchCount(12))
+	w.Hooks.Command = "echo $HIANIME_EPISODES >> " + ran
+
+	now := time.Now()
+	if err := w.Poll(now); err != nil {
+		t.Fatal(err)
+	}
+	if got := knownEpisodes(t); got != 12 {
+		t.Errorf("known episodes %d, want 12 even though the webhook failed", got)
+	}
+
+	// Still backing off: nothing runs.
+	if err := w.Poll(now.Add(30 * time.Second)); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(recv.received()); n != 1 {
+		t.Fatalf("got %d webhook posts during the backoff, want 1", n)
+	}
+
+	if err := w.Poll(now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	events := recv.received()
+	if len(events) != 2 || len(events[1].Episodes) != 2 || events[1].Episodes[0].Number != 11 {
+		t.Errorf("got %+v, want the webhook retried once with episodes 11 and 12", events)
+	}
+	out, err := os.ReadFile(ran)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Fields(string(out)); len(lines) != 1 || lines[0] != "11,12" {
+		t.Errorf("command ran with %q, want once with 11,12", lines)
+	}
+
+	// Everything went through, nothing is left to retry.
+	if err := w.Poll(now.Add(2 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(recv.received()); n != 2 {
+		t.Errorf("got %d webhook posts, want still 2", n)
+	}
+}
+
+func TestPollFailedCheckKeepsCount(t *testing.T) {
+	setup(t, 10)
+	recv := &receiver{}
+	srv := httptest.NewServer(recv)
+	defer srv.Close()
+
+	fail := true
+	w := newWatcher(srv, func(animeID string) ([]hianime.Episodes, error) {
+		if fail {
+			return nil, errors.New("503 Service Unavailable")
+		}
+		return fetchCount(12)(animeID)
+	})
+
+	now := time.Now()
+	if err := w.Poll(now); err != nil {
+		t.Fatal(err)
+	}
+	if got := knownEpisodes(t); got != 10 {
+		t.Errorf("known episodes %d, want 10 after a failed check", got)
+	}
+	if n := len(recv.received()); n != 0 {
+		t.Errorf("got %d webhook posts, want none", n)
+	}
+
+	fail = false
+	if err := w.Poll(now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if events := recv.received(); len(events) != 1 || len(events[0].Episodes) != 2 {
+		t.Errorf("got %+v, want episodes 11 and 12 reported once the check works", events)
+	}
+}
+
+func TestNewRejectsUnsupportedNotify(t *testing.T) {
+	_, err := New(config.WatchSettings{Notify: true})
+	if NotifySupported() && err != nil {
+		t.Errorf("New: %v", err)
+	}
+	if !NotifySupported() && err == nil {
+		t.Errorf("New accepted notify on %s", runtime.GOOS)
+	}
+}
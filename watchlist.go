@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"hianime-mpv-go/config"
+	"hianime-mpv-go/hianime"
+	"hianime-mpv-go/state"
+	"hianime-mpv-go/ui"
+)
+
+const watchlistUsage = `Usage:
+  watchlist [list]
+  watchlist add <url>
+  watchlist remove <number|url>
+  watchlist move <number|url> <position>
+  watchlist promote <number|url>
+
+'promote' takes the series off the watchlist and adds it to the library as watching.`
+
+func cmdWatchlist(args []string, history []state.History, configSession config.Settings) error {
+	action := "list"
+	if len(args) > 0 && args[0] != "" && args[0][0] != '-' {
+		action, args = args[0], args[1:]
+	}
+
+	switch action {
+	case "list":
+		return watchlistList(args)
+	case "add":
+		positional, err := parseInterleaved(newFlagSet("watchlist"), args)
+		if err != nil || len(positional) != 1 {
+			fmt.Fprintln(os.Stderr, watchlistUsage)
+			return errUsage
+		}
+		// Fetched before the store is locked, the page can take a while.
+		metaData, err := hianime.FetchSeriesData(positional[0])
+		if err != nil {
+			return fmt.Errorf("Failed to load the series: %w", err)
+		}
+		if metaData.AnimeID == "" {
+			return fmt.Errorf("Couldn't find series data for %s", positional[0])
+		}
+		_, err = state.UpdateWatchlist(func(list []state.WatchlistEntry) ([]state.WatchlistEntry, error) {
+			return state.AddToWatchlist(list, metaData)
+		})
+		if err != nil {
+			return err
+		}
+		fmt.Printf("--> %s added to the watchlist\n", metaData.JapaneseName)
+		return nil
+	case "remove":
+		return watchlistEdit(args, 1, func(list []state.WatchlistEntry, positional []string) ([]state.WatchlistEntry, error) {
+			return state.RemoveFromWatchlist(list, positional[0])
+		})
+	case "move":
+		return watchlistEdit(args, 2, func(list []state.WatchlistEntry, positional []string) ([]state.WatchlistEntry, error) {
+			to, err := strconv.Atoi(positional[1])
+			if err != nil {
+				return list, fmt.Errorf("Invalid position '%s'", positional[1])
+			}
+			return state.MoveInWatchlist(list, positional[0], to)
+		})
+	case "promote":
+		positional, err := parseInterleaved(newFlagSet("watchlist"), args)
+		if err != nil || len(positional) != 1 {
+			fmt.Fprintln(os.Stderr, watchlistUsage)
+			return errUsage
+		}
+		promoted, _, err := state.PromoteFromWatchlist(positional[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("--> %s moved to the library as watching\n", promoted.JapaneseName)
+		return nil
+	case "help":
+		fmt.Println(watchlistUsage)
+		return nil
+	}
+
+	fmt.Fprintln(os.Stderr, watchlistUsage)
+	return errUsage
+}
+
+func watchlistList(args []string) error {
+	positional, err := parseInterleaved(newFlagSet("watchlist list"), args)
+	if err != nil || len(positional) != 0 {
+		return errUsage
+	}
+
+	list, err := state.LoadWatchlist()
+	if err != nil {
+		return err
+	}
+
+	if ui.Output != ui.OutputText {
+		return ui.PrintRecords("watchlist", list)
+	}
+	if len(list) == 0 {
+		fmt.Println("--! The watchlist is empty")
+		return nil
+	}
+
+	ui.PrintWatchlist(list)
+	return nil
+}
+
+// watchlistEdit applies edit to the watchlist and saves it.
+func watchlistEdit(args []string, wantArgs int, edit func([]state.WatchlistEntry, []string) ([]state.WatchlistEntry, error)) error {
+	positional, err := parseInterleaved(newFlagSet("watchlist"), args)
+	if err != nil || len(positional) != wantArgs {
+		fmt.Fprintln(os.Stderr, watchlistUsage)
+		return errUsage
+	}
+
+	_, err = state.UpdateWatchlist(func(list []state.WatchlistEntry) ([]state.WatchlistEntry, error) {
+		return edit(list, positional)
+	})
+	return err
+}